@@ -0,0 +1,212 @@
+package denny
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// environment variables which override advertise settings, mostly useful in containers
+// where listen address is 0.0.0.0 and pod/host ip is injected by orchestrator
+const (
+	EnvAdvertiseAddr      = "DENNY_ADVERTISE_ADDR"
+	EnvAdvertiseInterface = "DENNY_ADVERTISE_INTERFACE"
+	EnvAdvertiseCIDR      = "DENNY_ADVERTISE_CIDR"
+	EnvAdvertiseIPv6      = "DENNY_ADVERTISE_IPV6"
+)
+
+// advertise describes how Denny picks address registered into naming registry
+type advertise struct {
+	// explicit host or host:port
+	addr string
+	// only consider ips of these interfaces
+	interfaces []string
+	// only consider ips belong to these networks
+	cidrs []*net.IPNet
+	// prefer ipv6 over ipv4
+	ipv6 bool
+}
+
+// WithAdvertiseAddress sets address registered into naming registry, it can be host or host:port,
+// when port is omitted, listen port is used
+func (r *Denny) WithAdvertiseAddress(addr string) *Denny {
+	r.advertise.addr = addr
+	return r
+}
+
+// WithAdvertiseInterface limits local ip lookup to given network interfaces, eg: eth0
+func (r *Denny) WithAdvertiseInterface(names ...string) *Denny {
+	r.advertise.interfaces = names
+	return r
+}
+
+// WithAdvertiseCIDR limits local ip lookup to given networks, eg: 10.0.0.0/8
+func (r *Denny) WithAdvertiseCIDR(cidrs ...string) *Denny {
+	nets, err := parseCIDRs(cidrs)
+	if err != nil {
+		panic(err)
+	}
+	r.advertise.cidrs = nets
+	return r
+}
+
+// WithAdvertiseIPv6 makes local ip lookup prefer ipv6 addresses
+func (r *Denny) WithAdvertiseIPv6() *Denny {
+	r.advertise.ipv6 = true
+	return r
+}
+
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, c := range cidrs {
+		c = strings.TrimSpace(c)
+		if len(c) == 0 {
+			continue
+		}
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func splitEnv(key string) []string {
+	var values []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// withEnv returns a copy of advertise settings overridden by environment variables
+func (a advertise) withEnv() (advertise, error) {
+	if addr := os.Getenv(EnvAdvertiseAddr); len(addr) > 0 {
+		a.addr = addr
+	}
+	if names := splitEnv(EnvAdvertiseInterface); len(names) > 0 {
+		a.interfaces = names
+	}
+	if cidrs := splitEnv(EnvAdvertiseCIDR); len(cidrs) > 0 {
+		nets, err := parseCIDRs(cidrs)
+		if err != nil {
+			return a, err
+		}
+		a.cidrs = nets
+	}
+	if v := os.Getenv(EnvAdvertiseIPv6); len(v) > 0 {
+		ipv6, err := strconv.ParseBool(v)
+		if err != nil {
+			return a, err
+		}
+		a.ipv6 = ipv6
+	}
+	return a, nil
+}
+
+// address composes host:port registered into naming registry from listen address,
+// listenAddr is address passed to GraceFulStart, it can be :port, 0.0.0.0:port, [::]:port,
+// ip:port or hostname:port, bound is actual listener address, used when port is 0
+func (a advertise) address(listenAddr string, bound net.Addr) (string, error) {
+	host, port, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return "", err
+	}
+	if tcpAddr, ok := bound.(*net.TCPAddr); ok && (port == "" || port == "0") {
+		port = strconv.Itoa(tcpAddr.Port)
+	}
+
+	if len(a.addr) > 0 {
+		if h, p, err := net.SplitHostPort(a.addr); err == nil {
+			return net.JoinHostPort(h, p), nil
+		}
+		// advertise address without port, ipv6 literal may be in brackets
+		return net.JoinHostPort(strings.Trim(a.addr, "[]"), port), nil
+	}
+
+	if ip := net.ParseIP(host); host != "" && (ip == nil || !ip.IsUnspecified()) {
+		// listen on a specific ip or hostname, advertise it as is
+		return net.JoinHostPort(host, port), nil
+	}
+
+	ip, err := a.localIp()
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(ip, port), nil
+}
+
+// localIp selects first non-loopback, non link-local ip which matches interface and cidr rules,
+// ipv4 is preferred unless ipv6 is set, the other family is used as fallback
+func (a advertise) localIp() (string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", err
+	}
+
+	var v4, v6 []net.IP
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		if len(a.interfaces) > 0 && !contains(a.interfaces, iface.Name) {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok || !a.acceptable(ipnet.IP) {
+				continue
+			}
+			if ipnet.IP.To4() != nil {
+				v4 = append(v4, ipnet.IP)
+			} else {
+				v6 = append(v6, ipnet.IP)
+			}
+		}
+	}
+
+	preferred, fallback := v4, v6
+	if a.ipv6 {
+		preferred, fallback = v6, v4
+	}
+	if len(preferred) > 0 {
+		return preferred[0].String(), nil
+	}
+	if len(fallback) > 0 {
+		return fallback[0].String(), nil
+	}
+	return "", errors.New("cannot lookup local ip address")
+}
+
+func (a advertise) acceptable(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() {
+		return false
+	}
+	if len(a.cidrs) == 0 {
+		return true
+	}
+	for _, n := range a.cidrs {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(l []string, s string) bool {
+	for i := range l {
+		if l[i] == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package denny
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// brpcContext is context of grpc method called over http, values are looked up
+// in http request context first, then in gin context (eg: values set by gin middleware)
+type brpcContext struct {
+	context.Context
+	gin *gin.Context
+}
+
+func (c brpcContext) Value(key interface{}) interface{} {
+	if v := c.Context.Value(key); v != nil {
+		return v
+	}
+	return c.gin.Value(key)
+}
+
+// brpcTransportStream collects header and trailer metadata set by grpc method
+// called over http via grpc.SetHeader, grpc.SendHeader and grpc.SetTrailer
+type brpcTransportStream struct {
+	sync.Mutex
+	method  string
+	header  metadata.MD
+	trailer metadata.MD
+}
+
+func (s *brpcTransportStream) Method() string {
+	return s.method
+}
+
+func (s *brpcTransportStream) SetHeader(md metadata.MD) error {
+	s.Lock()
+	defer s.Unlock()
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *brpcTransportStream) SendHeader(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+func (s *brpcTransportStream) SetTrailer(md metadata.MD) error {
+	s.Lock()
+	defer s.Unlock()
+	s.trailer = metadata.Join(s.trailer, md)
+	return nil
+}
+
+// newBrpcContext builds context of grpc method called over http: http headers become incoming metadata,
+// http client becomes peer and header/trailer metadata set by method are collected by returned stream
+func newBrpcContext(c *gin.Context, fullMethod string) (context.Context, *brpcTransportStream) {
+	md := make(metadata.MD, len(c.Request.Header))
+	for k, values := range c.Request.Header {
+		md[strings.ToLower(k)] = values
+	}
+	if c.Request.Host != "" {
+		md[":authority"] = []string{c.Request.Host}
+	}
+
+	var ctx context.Context = brpcContext{Context: c.Request.Context(), gin: c}
+	ctx = metadata.NewIncomingContext(ctx, md)
+	if addr, err := net.ResolveTCPAddr("tcp", c.Request.RemoteAddr); err == nil {
+		ctx = peer.NewContext(ctx, &peer.Peer{Addr: addr})
+	}
+	stream := &brpcTransportStream{method: fullMethod}
+	return grpc.NewContextWithServerTransportStream(ctx, stream), stream
+}
+
+// writeMetadata maps header metadata set by grpc method to http response headers
+// and trailer metadata to Grpc-Trailer- prefixed headers
+func (s *brpcTransportStream) writeMetadata(c *gin.Context) {
+	s.Lock()
+	defer s.Unlock()
+	for k, values := range s.header {
+		for _, v := range values {
+			c.Writer.Header().Add(k, v)
+		}
+	}
+	for k, values := range s.trailer {
+		for _, v := range values {
+			c.Writer.Header().Add("Grpc-Trailer-"+k, v)
+		}
+	}
+}
+
+// brpcService is grpc service whose rpc methods are served over http
+type brpcService struct {
+	// name is full proto service name, eg: pb.HelloService
+	name    string
+	methods []string
+}
+
+// routeName returns short service name without "Service" suffix, it's the first segment of endpoints
+func (s *brpcService) routeName() string {
+	name := s.name[strings.LastIndex(s.name, ".")+1:]
+	if trimmed := strings.TrimSuffix(name, "Service"); trimmed != "" {
+		return trimmed
+	}
+	return name
+}
+
+// serviceFromDesc returns unary methods of service described by grpc.ServiceDesc,
+// impl must implement service handler interface, streaming methods are not served over http
+func serviceFromDesc(desc *grpc.ServiceDesc, impl interface{}) (*brpcService, error) {
+	if desc.HandlerType != nil {
+		handlerType := reflect.TypeOf(desc.HandlerType).Elem()
+		if !reflect.TypeOf(impl).Implements(handlerType) {
+			return nil, fmt.Errorf("%w: %T does not implement %s", invalidMethodType, impl, handlerType)
+		}
+	}
+	service := &brpcService{name: desc.ServiceName}
+	for _, m := range desc.Methods {
+		service.methods = append(service.methods, m.MethodName)
+	}
+	return service, nil
+}
+
+// discoverService finds service implemented by impl among services registered to grpc server attached to Denny,
+// service matches when impl has all its unary methods, ok is false when no service matches
+func (r *Denny) discoverService(impl interface{}) (service *brpcService, ok bool, err error) {
+	if r == nil || r.grpcServer == nil {
+		return nil, false, nil
+	}
+	var (
+		implType   = reflect.TypeOf(impl)
+		implName   = reflect.Indirect(reflect.ValueOf(impl)).Type().Name()
+		candidates []*brpcService
+	)
+	for name, info := range r.grpcServer.GetServiceInfo() {
+		candidate := &brpcService{name: name}
+		matched := true
+		for _, m := range info.Methods {
+			if m.IsClientStream || m.IsServerStream {
+				continue
+			}
+			if _, found := implType.MethodByName(m.Name); !found {
+				matched = false
+				break
+			}
+			candidate.methods = append(candidate.methods, m.Name)
+		}
+		if matched && len(candidate.methods) > 0 {
+			candidates = append(candidates, candidate)
+		}
+	}
+	switch len(candidates) {
+	case 0:
+		return nil, false, nil
+	case 1:
+		return candidates[0], true, nil
+	}
+	var names []string
+	for _, candidate := range candidates {
+		if candidate.routeName() == strings.TrimSuffix(implName, "Service") {
+			return candidate, true, nil
+		}
+		names = append(names, candidate.name)
+	}
+	sort.Strings(names)
+	return nil, false, fmt.Errorf("%s implements several grpc services: %s, pass grpc.ServiceDesc to BrpcController",
+		implName, strings.Join(names, ", "))
+}
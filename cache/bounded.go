@@ -0,0 +1,821 @@
+package cache
+
+import (
+	"container/heap"
+	"container/list"
+	"context"
+	"hash/fnv"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Policy decides which entry is evicted when bounded cache is full
+type Policy int
+
+const (
+	// LRU evicts least recently used entry
+	LRU Policy = iota
+	// LFU evicts least frequently used entry, among entries with the same frequency the oldest one,
+	// frequencies are halved periodically so entries which are no longer used are evicted eventually
+	LFU
+	// FIFO evicts oldest entry
+	FIFO
+)
+
+// EvictReason tells why entry was removed from bounded cache
+type EvictReason int
+
+const (
+	// EvictedCapacity means entry was evicted to respect MaxEntries or MaxBytes
+	EvictedCapacity EvictReason = iota
+	// EvictedExpired means entry expired
+	EvictedExpired
+)
+
+func (r EvictReason) String() string {
+	if r == EvictedExpired {
+		return "expired"
+	}
+	return "capacity"
+}
+
+// BoundedConfig configures bounded memory cache, limits are split across shards so they add up to configured ones,
+// Config.Load is honored by GetOrElse, expired entry is kept for stale window then
+type BoundedConfig struct {
+	Config
+	Policy Policy
+	// MaxEntries limits number of entries, 0 means no limit
+	MaxEntries int
+	// MaxBytes limits approximate size of entries, 0 means no limit. Each shard holds its share of it,
+	// so entry larger than MaxBytes/Shards is not stored and counted in Stats.Rejections,
+	// use fewer shards to cache entries which take a large part of MaxBytes
+	MaxBytes int64
+	// Shards is number of independently locked shards, default is 16
+	Shards int
+	// Sizer returns approximate size in bytes of value, default estimates it by walking value with reflection,
+	// set it when size is known cheaper (eg: len of encoded value)
+	Sizer func(key string, value interface{}) int64
+	// OnEvict is called when entry is evicted because of limits or expiry, it's not called on Delete
+	OnEvict func(key string, value interface{}, reason EvictReason)
+}
+
+const defaultShards = 16
+
+// lfuAgingFactor is number of accesses per entry after which LFU frequencies are halved
+const lfuAgingFactor = 10
+
+type boundedEntry struct {
+	key      string
+	value    interface{}
+	deadline time.Time
+	size     int64
+	// policy bookkeeping
+	elem  *list.Element
+	index int
+	freq  int64
+	seq   int64
+}
+
+func (e *boundedEntry) expired(now time.Time) bool {
+	return !e.deadline.IsZero() && now.After(e.deadline)
+}
+
+// evictionPolicy tracks entries of a shard and picks eviction victim
+type evictionPolicy interface {
+	add(e *boundedEntry)
+	access(e *boundedEntry)
+	remove(e *boundedEntry)
+	victim() *boundedEntry
+}
+
+// listPolicy implements LRU and FIFO, front of list is evicted last
+type listPolicy struct {
+	l         *list.List
+	moveOnUse bool
+}
+
+func (p *listPolicy) add(e *boundedEntry) {
+	e.elem = p.l.PushFront(e)
+}
+
+func (p *listPolicy) access(e *boundedEntry) {
+	if p.moveOnUse {
+		p.l.MoveToFront(e.elem)
+	}
+}
+
+func (p *listPolicy) remove(e *boundedEntry) {
+	p.l.Remove(e.elem)
+}
+
+func (p *listPolicy) victim() *boundedEntry {
+	if back := p.l.Back(); back != nil {
+		return back.Value.(*boundedEntry)
+	}
+	return nil
+}
+
+// lfuPolicy is min heap of entries ordered by frequency then insertion order
+type lfuPolicy struct {
+	entries []*boundedEntry
+	seq     int64
+	// accesses since frequencies were halved
+	accesses int64
+}
+
+func (p *lfuPolicy) Len() int { return len(p.entries) }
+
+func (p *lfuPolicy) Less(i, j int) bool {
+	a, b := p.entries[i], p.entries[j]
+	if a.freq != b.freq {
+		return a.freq < b.freq
+	}
+	return a.seq < b.seq
+}
+
+func (p *lfuPolicy) Swap(i, j int) {
+	p.entries[i], p.entries[j] = p.entries[j], p.entries[i]
+	p.entries[i].index = i
+	p.entries[j].index = j
+}
+
+func (p *lfuPolicy) Push(x interface{}) {
+	e := x.(*boundedEntry)
+	e.index = len(p.entries)
+	p.entries = append(p.entries, e)
+}
+
+func (p *lfuPolicy) Pop() interface{} {
+	last := p.entries[len(p.entries)-1]
+	p.entries = p.entries[:len(p.entries)-1]
+	return last
+}
+
+func (p *lfuPolicy) add(e *boundedEntry) {
+	p.seq++
+	e.freq, e.seq = 1, p.seq
+	heap.Push(p, e)
+}
+
+func (p *lfuPolicy) access(e *boundedEntry) {
+	e.freq++
+	heap.Fix(p, e.index)
+	p.accesses++
+	if p.accesses >= lfuAgingFactor*int64(len(p.entries)) {
+		p.age()
+	}
+}
+
+// age halves frequencies so entries popular in the past do not stay forever
+func (p *lfuPolicy) age() {
+	p.accesses = 0
+	for _, e := range p.entries {
+		e.freq = (e.freq + 1) / 2
+	}
+	heap.Init(p)
+}
+
+func (p *lfuPolicy) remove(e *boundedEntry) {
+	heap.Remove(p, e.index)
+}
+
+func (p *lfuPolicy) victim() *boundedEntry {
+	if len(p.entries) == 0 {
+		return nil
+	}
+	return p.entries[0]
+}
+
+func newEvictionPolicy(policy Policy) evictionPolicy {
+	switch policy {
+	case LFU:
+		return &lfuPolicy{}
+	case FIFO:
+		return &listPolicy{l: list.New()}
+	default:
+		return &listPolicy{l: list.New(), moveOnUse: true}
+	}
+}
+
+type evicted struct {
+	key    string
+	value  interface{}
+	reason EvictReason
+}
+
+type shard struct {
+	sync.Mutex
+	entries    map[string]*boundedEntry
+	policy     evictionPolicy
+	bytes      int64
+	maxEntries int
+	maxBytes   int64
+	// stale is how long expired entry is kept so GetOrElse can serve it while reloading
+	stale time.Duration
+}
+
+// dead reports whether entry expired and its stale window passed
+func (s *shard) dead(e *boundedEntry, now time.Time) bool {
+	return !e.deadline.IsZero() && now.Sub(e.deadline) > s.stale
+}
+
+// peek returns entry which is live or expired within stale window,
+// dead entry is removed and reported to evicted
+func (s *shard) peek(key string, now time.Time, evictions *[]evicted) (*boundedEntry, bool) {
+	e, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if s.dead(e, now) {
+		s.remove(e)
+		*evictions = append(*evictions, evicted{e.key, e.value, EvictedExpired})
+		return nil, false
+	}
+	return e, true
+}
+
+// get returns live entry
+func (s *shard) get(key string, now time.Time, evictions *[]evicted) (*boundedEntry, bool) {
+	e, ok := s.peek(key, now, evictions)
+	if !ok || e.expired(now) {
+		return nil, false
+	}
+	return e, true
+}
+
+func (s *shard) remove(e *boundedEntry) {
+	s.policy.remove(e)
+	delete(s.entries, e.key)
+	s.bytes -= e.size
+}
+
+// set stores entry and evicts entries until shard respects its limits,
+// entry larger than size limit of shard is rejected, false is returned and previous value of key is removed
+func (s *shard) set(e *boundedEntry, evictions *[]evicted) bool {
+	if old, ok := s.entries[e.key]; ok {
+		s.remove(old)
+	}
+	if s.maxBytes > 0 && e.size > s.maxBytes {
+		return false
+	}
+	s.entries[e.key] = e
+	s.bytes += e.size
+	s.policy.add(e)
+	for s.full() {
+		victim := s.policy.victim()
+		if victim == nil {
+			break
+		}
+		s.remove(victim)
+		*evictions = append(*evictions, evicted{victim.key, victim.value, EvictedCapacity})
+	}
+	return true
+}
+
+func (s *shard) full() bool {
+	return (s.maxEntries > 0 && len(s.entries) > s.maxEntries) ||
+		(s.maxBytes > 0 && s.bytes > s.maxBytes)
+}
+
+type bounded struct {
+	stats   *recorder
+	tags    tagIndex
+	policy  Policy
+	shards  []*shard
+	sizer   func(key string, value interface{}) int64
+	onEvict func(key string, value interface{}, reason EvictReason)
+	loader  *loader
+}
+
+// NewBoundedMemoryCache creates memory cache limited by number of entries and/or approximate size,
+// entries are evicted using configured policy. Expired entries are never returned, they are removed
+// on access and by gc routine when Config.GcDuration is set
+func NewBoundedMemoryCache(cfg BoundedConfig) Cache {
+	shards := cfg.Shards
+	if shards <= 0 {
+		shards = defaultShards
+	}
+	if cfg.MaxEntries > 0 && shards > cfg.MaxEntries {
+		shards = cfg.MaxEntries
+	}
+	if cfg.MaxBytes > 0 && int64(shards) > cfg.MaxBytes {
+		shards = int(cfg.MaxBytes)
+	}
+	stats := &recorder{}
+	c := &bounded{
+		stats:   stats,
+		policy:  cfg.Policy,
+		shards:  make([]*shard, shards),
+		sizer:   cfg.Sizer,
+		onEvict: cfg.OnEvict,
+		loader:  &loader{cfg: cfg.Load, stats: stats},
+	}
+	if c.sizer == nil {
+		c.sizer = sizeOf
+	}
+	for i := range c.shards {
+		c.shards[i] = &shard{
+			entries:    make(map[string]*boundedEntry),
+			policy:     newEvictionPolicy(cfg.Policy),
+			maxEntries: int(share(int64(cfg.MaxEntries), shards, i)),
+			maxBytes:   share(cfg.MaxBytes, shards, i),
+			stale:      cfg.Load.StaleWhileRevalidate,
+		}
+	}
+	if cfg.GcDuration > 0 {
+		go c.runGc(cfg.Config)
+	}
+	return c
+}
+
+// share returns limit of i-th of n shards, remainder of total is given to first shards
+// so limits of shards add up to total
+func share(total int64, n, i int) int64 {
+	limit := total / int64(n)
+	if int64(i) < total%int64(n) {
+		limit++
+	}
+	return limit
+}
+
+func (c *bounded) shard(key string) *shard {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return c.shards[h.Sum32()%uint32(len(c.shards))]
+}
+
+func (c *bounded) notify(evictions []evicted) {
+	for _, e := range evictions {
+		c.stats.evict(e.key)
+		c.loader.forget(e.key)
+		if c.onEvict != nil {
+			c.onEvict(e.key, e.value, e.reason)
+		}
+	}
+}
+
+func (c *bounded) lookup(key string) (interface{}, bool) {
+	var (
+		s         = c.shard(key)
+		evictions []evicted
+	)
+	s.Lock()
+	e, ok := s.get(key, time.Now(), &evictions)
+	var v interface{}
+	if ok {
+		s.policy.access(e)
+		v = e.value
+	}
+	s.Unlock()
+	c.notify(evictions)
+	return v, ok
+}
+
+// peek returns value of key which is live or expired within stale window with its deadline
+func (c *bounded) peek(key string) (interface{}, time.Time, bool) {
+	var (
+		s         = c.shard(key)
+		evictions []evicted
+		v         interface{}
+		deadline  time.Time
+	)
+	s.Lock()
+	e, ok := s.peek(key, time.Now(), &evictions)
+	if ok {
+		s.policy.access(e)
+		v, deadline = e.value, e.deadline
+	}
+	s.Unlock()
+	c.notify(evictions)
+	return v, deadline, ok
+}
+
+// SetWithTTL store value, 0 ttl means value never expires
+func (c *bounded) SetWithTTL(key string, val interface{}, ttl time.Duration) {
+	var (
+		s         = c.shard(key)
+		e         = &boundedEntry{key: key, value: val, size: c.sizer(key, val)}
+		evictions []evicted
+	)
+	if ttl > 0 {
+		e.deadline = time.Now().Add(ttl)
+	}
+	s.Lock()
+	stored := s.set(e, &evictions)
+	s.Unlock()
+	if !stored {
+		c.stats.reject(key)
+	}
+	c.notify(evictions)
+}
+
+// Get return value if key exist or nil if it does not
+func (c *bounded) Get(key string) interface{} {
+	v, ok := c.lookup(key)
+	c.stats.hit(key, ok)
+	return v
+}
+
+// GetOrElse return value if it exists, else warmup using warmup function,
+// concurrent misses of the same key share one warmup call
+func (c *bounded) GetOrElse(key string, wuf func(key string) interface{}, expire ...int64) interface{} {
+	var expired int64 = 0
+	if len(expire) > 0 {
+		expired = expire[0]
+	}
+	warmUp := func() interface{} {
+		if v := wuf(key); v != nil {
+			c.Set(key, v, expired)
+			return v
+		}
+		return nil
+	}
+	if v, deadline, ok := c.peek(key); ok {
+		remaining := time.Until(deadline)
+		switch {
+		case deadline.IsZero():
+		case remaining > 0:
+			if c.loader.refreshEarly(key, remaining) {
+				c.loader.refresh(key, warmUp)
+			}
+		default:
+			// expired within stale window
+			c.loader.refresh(key, warmUp)
+		}
+		c.stats.hit(key, true)
+		return v
+	}
+	c.stats.hit(key, false)
+	return c.loader.load(key, func() interface{} {
+		// value may be loaded by previous call while this one waited
+		if v, ok := c.lookup(key); ok {
+			return v
+		}
+		return warmUp()
+	})
+}
+
+// Set store value, expire is in second, 0 means value never expires
+func (c *bounded) Set(key string, val interface{}, expire int64) {
+	c.SetWithTTL(key, val, time.Duration(expire)*time.Second)
+}
+
+// GetMulti returns values of given keys, value of missing key is nil
+func (c *bounded) GetMulti(keys []string) []interface{} {
+	values := make([]interface{}, len(keys))
+	for i, k := range keys {
+		values[i] = c.Get(k)
+	}
+	return values
+}
+
+// Delete delete key if it exists
+func (c *bounded) Delete(key string) {
+	s := c.shard(key)
+	s.Lock()
+	if e, ok := s.entries[key]; ok {
+		s.remove(e)
+	}
+	s.Unlock()
+	c.loader.forget(key)
+}
+
+func (c *bounded) add(key string, delta int64) (int64, error) {
+	var (
+		s         = c.shard(key)
+		evictions []evicted
+	)
+	s.Lock()
+	e, ok := s.get(key, time.Now(), &evictions)
+	if !ok {
+		// missing key is created with value delta and no expiry as redis does
+		s.set(&boundedEntry{key: key, value: delta, size: c.sizer(key, delta)}, &evictions)
+		s.Unlock()
+		c.notify(evictions)
+		return delta, nil
+	}
+	i, ok := e.value.(int64)
+	if ok {
+		e.value = i + delta
+		s.policy.access(e)
+	}
+	s.Unlock()
+	c.notify(evictions)
+	if !ok {
+		return 0, InvalidValueTypeError
+	}
+	return i + delta, nil
+}
+
+// Incr increases int64 value of key by one keeping its expiry
+func (c *bounded) Incr(key string) error {
+	_, err := c.add(key, 1)
+	return err
+}
+
+// Decr decreases int64 value of key by one keeping its expiry
+func (c *bounded) Decr(key string) error {
+	_, err := c.add(key, -1)
+	return err
+}
+
+// IncrBy increases int64 value of key by delta keeping its expiry
+func (c *bounded) IncrBy(key string, delta int64) (int64, error) {
+	return c.add(key, delta)
+}
+
+// DecrBy decreases int64 value of key by delta keeping its expiry
+func (c *bounded) DecrBy(key string, delta int64) (int64, error) {
+	return c.add(key, -delta)
+}
+
+// SetMulti stores values, each shard is locked once
+func (c *bounded) SetMulti(items map[string]Item) {
+	var (
+		now       = time.Now()
+		byShard   = make(map[*shard][]*boundedEntry)
+		evictions []evicted
+	)
+	for k, v := range items {
+		e := &boundedEntry{key: k, value: v.Value, size: c.sizer(k, v.Value)}
+		if v.TTL > 0 {
+			e.deadline = now.Add(v.TTL)
+		}
+		s := c.shard(k)
+		byShard[s] = append(byShard[s], e)
+	}
+	var rejected []string
+	for s, entries := range byShard {
+		s.Lock()
+		for _, e := range entries {
+			if !s.set(e, &evictions) {
+				rejected = append(rejected, e.key)
+			}
+		}
+		s.Unlock()
+	}
+	for _, key := range rejected {
+		c.stats.reject(key)
+	}
+	c.notify(evictions)
+}
+
+// DeleteMulti deletes keys
+func (c *bounded) DeleteMulti(keys []string) {
+	for _, k := range keys {
+		c.Delete(k)
+	}
+}
+
+// GetOrElseMulti returns values of keys, missing ones are loaded by one loader call
+func (c *bounded) GetOrElseMulti(keys []string, loader func(keys []string) map[string]interface{}, expire ...int64) []interface{} {
+	return getOrElseMulti(c, c.stats, keys, loader, expire...)
+}
+
+// update calls fn with live entry of key under shard lock
+func (c *bounded) update(key string, fn func(s *shard, e *boundedEntry)) error {
+	var (
+		s         = c.shard(key)
+		evictions []evicted
+	)
+	s.Lock()
+	e, ok := s.get(key, time.Now(), &evictions)
+	if ok {
+		fn(s, e)
+	}
+	s.Unlock()
+	c.notify(evictions)
+	if !ok {
+		return ValueNotExistError
+	}
+	return nil
+}
+
+// TTL returns remaining time to live of key, NoExpiration when key never expires
+func (c *bounded) TTL(key string) (time.Duration, error) {
+	ttl := NoExpiration
+	err := c.update(key, func(_ *shard, e *boundedEntry) {
+		if !e.deadline.IsZero() {
+			ttl = time.Until(e.deadline)
+		}
+	})
+	return ttl, err
+}
+
+// Expire sets time to live of key, non positive ttl deletes key
+func (c *bounded) Expire(key string, ttl time.Duration) error {
+	return c.update(key, func(s *shard, e *boundedEntry) {
+		if ttl <= 0 {
+			s.remove(e)
+			return
+		}
+		e.deadline = time.Now().Add(ttl)
+	})
+}
+
+// Persist removes expiry of key
+func (c *bounded) Persist(key string) error {
+	return c.update(key, func(_ *shard, e *boundedEntry) {
+		e.deadline = time.Time{}
+	})
+}
+
+// Stats returns statistics of cache, entries evicted by limits or expiry are counted as evictions
+func (c *bounded) Stats() Stats {
+	var size int64
+	for _, s := range c.shards {
+		s.Lock()
+		size += int64(len(s.entries))
+		s.Unlock()
+	}
+	return c.stats.stats(size)
+}
+
+func (c *bounded) IsExist(key string) bool {
+	_, ok := c.lookup(key)
+	return ok
+}
+
+func (c *bounded) ClearAll() {
+	for _, s := range c.shards {
+		s.Lock()
+		s.entries = make(map[string]*boundedEntry)
+		s.policy = newEvictionPolicy(c.policy)
+		s.bytes = 0
+		s.Unlock()
+	}
+	c.tags.clear()
+	c.loader.reset()
+}
+
+// SetWithTags stores value and attaches tags to key
+func (c *bounded) SetWithTags(key string, val interface{}, ttl time.Duration, tags ...string) {
+	c.SetWithTTL(key, val, ttl)
+	c.tags.add(key, tags)
+}
+
+// InvalidateTags deletes every key attached to given tags
+func (c *bounded) InvalidateTags(tags ...string) error {
+	for _, key := range c.tags.take(tags) {
+		c.Delete(key)
+	}
+	return nil
+}
+
+// deletePrefix deletes every key starting with prefix
+func (c *bounded) deletePrefix(prefix string) error {
+	for _, s := range c.shards {
+		s.Lock()
+		for k, e := range s.entries {
+			if strings.HasPrefix(k, prefix) {
+				s.remove(e)
+			}
+		}
+		s.Unlock()
+	}
+	return nil
+}
+
+func (c *bounded) runGc(config Config) {
+	for {
+		<-time.After(time.Duration(config.GcDuration) * time.Second)
+		now := time.Now()
+		for _, s := range c.shards {
+			var evictions []evicted
+			s.Lock()
+			for _, e := range s.entries {
+				if s.dead(e, now) {
+					s.remove(e)
+					evictions = append(evictions, evicted{e.key, e.value, EvictedExpired})
+				}
+			}
+			s.Unlock()
+			c.notify(evictions)
+		}
+		c.tags.prune(func(key string) bool {
+			s := c.shard(key)
+			s.Lock()
+			defer s.Unlock()
+			_, ok := s.entries[key]
+			return ok
+		})
+	}
+}
+
+// GetContext returns value or ValueNotExistError when key does not exist
+func (c *bounded) GetContext(ctx context.Context, key string) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	v, ok := c.lookup(key)
+	c.stats.hit(key, ok)
+	if !ok {
+		return nil, ValueNotExistError
+	}
+	return v, nil
+}
+
+// GetMultiContext returns values of keys, values of missing keys are nil
+func (c *bounded) GetMultiContext(ctx context.Context, keys []string) ([]interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.GetMulti(keys), nil
+}
+
+// SetContext stores value with given ttl
+func (c *bounded) SetContext(ctx context.Context, key string, val interface{}, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.SetWithTTL(key, val, ttl)
+	return nil
+}
+
+// DeleteContext deletes key if it exists
+func (c *bounded) DeleteContext(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.Delete(key)
+	return nil
+}
+
+// sizeOf estimates size of entry, values of other types than strings, bytes and numbers are measured
+// by walking them with reflection, nested values deeper than maxSizeDepth are not counted
+func sizeOf(key string, value interface{}) int64 {
+	size := int64(len(key))
+	switch v := value.(type) {
+	case string:
+		return size + int64(len(v))
+	case []byte:
+		return size + int64(len(v))
+	case bool, int8, uint8:
+		return size + 1
+	case int16, uint16:
+		return size + 2
+	case int32, uint32, float32:
+		return size + 4
+	case int, uint, int64, uint64, float64, uintptr:
+		return size + 8
+	}
+	return size + sizeOfValue(reflect.ValueOf(value), maxSizeDepth)
+}
+
+// maxSizeDepth bounds how deep sizeOf walks values, it also stops walking cyclic values
+const maxSizeDepth = 8
+
+func sizeOfValue(v reflect.Value, depth int) int64 {
+	if !v.IsValid() {
+		return 0
+	}
+	size := int64(v.Type().Size())
+	if depth == 0 {
+		return size
+	}
+	switch v.Kind() {
+	case reflect.String:
+		size += int64(v.Len())
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			size += sizeOfValue(v.Elem(), depth-1)
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice {
+			size = int64(v.Type().Size())
+		} else {
+			size = 0
+		}
+		if fixedSize(v.Type().Elem().Kind()) {
+			size += int64(v.Len()) * int64(v.Type().Elem().Size())
+			break
+		}
+		for i := 0; i < v.Len(); i++ {
+			size += sizeOfValue(v.Index(i), depth-1)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			size += sizeOfValue(iter.Key(), depth-1) + sizeOfValue(iter.Value(), depth-1)
+		}
+	case reflect.Struct:
+		size = 0
+		for i := 0; i < v.NumField(); i++ {
+			size += sizeOfValue(v.Field(i), depth-1)
+		}
+	}
+	return size
+}
+
+// fixedSize reports whether values of kind have no data outside of themselves
+func fixedSize(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return true
+	}
+	return false
+}
@@ -1,7 +1,12 @@
+// Package cache provides memory, bounded, redis and tiered caches behind Cache interface.
+// Typed cache (NewTyped) uses generics, it's only built by go 1.18 or later,
+// older toolchains build the rest of the package without it
 package cache
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"time"
 )
 
@@ -10,6 +15,48 @@ var (
 	InvalidValueTypeError = errors.New("invalid value type")
 )
 
+// DecodeError is returned when cached value can not be decoded by codec
+type DecodeError struct {
+	Key string
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("cache: decode value of %q: %v", e.Key, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// BackendError is returned when cache backend (eg: redis) fails to serve a call
+type BackendError struct {
+	Op  string
+	Key string
+	Err error
+}
+
+func (e *BackendError) Error() string {
+	return fmt.Sprintf("cache: %s %q: %v", e.Op, e.Key, e.Err)
+}
+
+func (e *BackendError) Unwrap() error {
+	return e.Err
+}
+
+// ContextCache is implemented by built-in backends, unlike Cache its methods accept context
+// and return errors: miss is reported as ValueNotExistError, backend failure as *BackendError
+type ContextCache interface {
+	// GetContext returns cached value, redis backend returns value as string
+	GetContext(ctx context.Context, key string) (interface{}, error)
+	// SetContext stores value, zero ttl means value never expires
+	SetContext(ctx context.Context, key string, val interface{}, ttl time.Duration) error
+	// DeleteContext deletes value, deleting missing key is not an error
+	DeleteContext(ctx context.Context, key string) error
+	// GetMultiContext is a batch version of GetContext, values of missing keys are nil
+	GetMultiContext(ctx context.Context, keys []string) ([]interface{}, error)
+}
+
 type Cache interface {
 	// get cached value by key.
 	Get(key string) interface{}
@@ -21,19 +68,142 @@ type Cache interface {
 	Set(key string, val interface{}, expire int64)
 	// delete cached value by key.
 	Delete(key string)
-	// increase cached int value by key, as a counter.
+	// increase cached int value by key, as a counter, missing key is created with value 1.
 	Incr(key string) error
-	// decrease cached int value by key, as a counter.
+	// decrease cached int value by key, as a counter, missing key is created with value -1.
 	Decr(key string) error
 	// check if cached value exists or not.
 	IsExist(key string) bool
 	// clear all cache.
 	ClearAll()
+	// SetMulti is a batch version of Set, every item has its own ttl.
+	SetMulti(items map[string]Item)
+	// DeleteMulti is a batch version of Delete.
+	DeleteMulti(keys []string)
+	// IncrBy increases cached int value by delta and returns new value, missing key is created with value delta.
+	IncrBy(key string, delta int64) (int64, error)
+	// DecrBy decreases cached int value by delta and returns new value, missing key is created with value -delta.
+	DecrBy(key string, delta int64) (int64, error)
+	// GetOrElseMulti is a batch version of GetOrElse, missing keys are loaded by one loader call,
+	// loader returns values of keys it found.
+	GetOrElseMulti(keys []string, loader func(keys []string) map[string]interface{}, expire ...int64) []interface{}
+	// Stats returns hit/miss, loading and eviction statistics
+	Stats() Stats
 	// start gc routine based on config string settings.
 	runGc(config Config)
 }
 
+// Item is value stored by SetMulti, zero TTL means value never expires
+type Item struct {
+	Value interface{}
+	TTL   time.Duration
+}
+
+// getOrElseMulti implements GetOrElseMulti on top of GetMulti and SetMulti,
+// each loaded key is recorded as a load taking its share of loader call
+func getOrElseMulti(c Cache, stats *recorder, keys []string, loader func(keys []string) map[string]interface{}, expire ...int64) []interface{} {
+	var (
+		values  = c.GetMulti(keys)
+		missing []string
+	)
+	if len(values) != len(keys) {
+		// backend failure, values are loaded again
+		values = make([]interface{}, len(keys))
+	}
+	for i, v := range values {
+		if v == nil {
+			missing = append(missing, keys[i])
+		}
+	}
+	if len(missing) == 0 {
+		return values
+	}
+	start := time.Now()
+	loaded := loader(missing)
+	elapsed := time.Since(start) / time.Duration(len(missing))
+	var ttl time.Duration
+	if len(expire) > 0 {
+		ttl = time.Duration(expire[0]) * time.Second
+	}
+	items := make(map[string]Item, len(loaded))
+	for _, key := range missing {
+		v, ok := loaded[key]
+		stats.load(key, elapsed, !ok || v == nil)
+		if ok && v != nil {
+			items[key] = Item{Value: v, TTL: ttl}
+		}
+	}
+	if len(items) > 0 {
+		c.SetMulti(items)
+	}
+	for i, key := range keys {
+		if values[i] == nil {
+			values[i] = items[key].Value
+		}
+	}
+	return values
+}
+
+// NoExpiration is returned by TTL for key which never expires
+const NoExpiration time.Duration = -1
+
+// Expirer is implemented by built-in backends, it inspects and changes expiry of keys
+// with time.Duration precision
+type Expirer interface {
+	// SetWithTTL stores value, zero ttl means value never expires
+	SetWithTTL(key string, val interface{}, ttl time.Duration)
+	// TTL returns remaining time to live of key, NoExpiration when key never expires
+	// and ValueNotExistError when key does not exist
+	TTL(key string) (time.Duration, error)
+	// Expire sets time to live of existing key
+	Expire(key string, ttl time.Duration) error
+	// Persist removes expiry of existing key
+	Persist(key string) error
+}
+
 type Config struct {
 	GcDuration time.Duration
 	GcEvery    int //second
+	// Load controls GetOrElse loading behaviour
+	Load LoadConfig
+}
+
+// contextAdapter adapts Cache which does not implement ContextCache,
+// ttl is rounded up to second as Cache does not support smaller unit
+type contextAdapter struct {
+	Cache
+}
+
+func (a contextAdapter) GetContext(ctx context.Context, key string) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	v := a.Get(key)
+	if v == nil {
+		return nil, ValueNotExistError
+	}
+	return v, nil
+}
+
+func (a contextAdapter) GetMultiContext(ctx context.Context, keys []string) ([]interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.GetMulti(keys), nil
+}
+
+func (a contextAdapter) SetContext(ctx context.Context, key string, val interface{}, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	a.Set(key, val, int64((ttl+time.Second-1)/time.Second))
+	return nil
+}
+
+func (a contextAdapter) DeleteContext(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	a.Delete(key)
+	return nil
 }
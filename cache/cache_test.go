@@ -1,8 +1,18 @@
 package cache
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 func TestMemoryCache(t *testing.T) {
@@ -34,3 +44,676 @@ func TestMemoryCache(t *testing.T) {
 	}
 
 }
+
+func TestGetOrElseCoalesce(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	var (
+		lock   = LoadConfig{LockTTL: time.Second}
+		caches = map[string][]Cache{
+			"memory": {NewMemoryCache(Config{GcDuration: 60})},
+			// two processes sharing redis
+			"redis": {
+				NewRedisWithConfig(RedisConfig{Options: RedisOptions{Addr: server.Addr()}, Load: lock}),
+				NewRedisWithConfig(RedisConfig{Options: RedisOptions{Addr: server.Addr()}, Load: lock}),
+			},
+		}
+	)
+	for name, cs := range caches {
+		var (
+			calls int32
+			wg    sync.WaitGroup
+		)
+		warmUp := func(key string) interface{} {
+			atomic.AddInt32(&calls, 1)
+			time.Sleep(100 * time.Millisecond)
+			return "denny"
+		}
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(c Cache) {
+				defer wg.Done()
+				if v := c.GetOrElse("hot", warmUp, 60); v != "denny" {
+					t.Errorf("%s: wrong value %v", name, v)
+				}
+			}(cs[i%len(cs)])
+		}
+		wg.Wait()
+		if calls != 1 {
+			t.Errorf("%s: warm up called %d times", name, calls)
+		}
+	}
+}
+
+func TestGetOrElseStale(t *testing.T) {
+	var (
+		c = NewMemoryCache(Config{
+			GcDuration: 60,
+			Load:       LoadConfig{StaleWhileRevalidate: time.Minute},
+		})
+		version int32
+		warmUp  = func(key string) interface{} {
+			return atomic.AddInt32(&version, 1)
+		}
+	)
+	if v := c.GetOrElse("key", warmUp, 1); v != int32(1) {
+		t.Fatalf("wrong value %v", v)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	// stale value is served while it's reloaded in background
+	if v := c.GetOrElse("key", warmUp, 1); v != int32(1) {
+		t.Errorf("expect stale value, got %v", v)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if v := c.GetOrElse("key", warmUp, 1); v != int32(2) {
+		t.Errorf("expect refreshed value, got %v", v)
+	}
+}
+
+func TestLoaderDeltas(t *testing.T) {
+	warmUp := func(key string) interface{} { return key }
+	plain := NewMemoryCache(Config{GcDuration: 60}).(*memory)
+	plain.GetOrElse("key", warmUp, 60)
+	if len(plain.loader.deltas) != 0 {
+		t.Errorf("warm up duration is kept without early refresh: %v", plain.loader.deltas)
+	}
+
+	c := NewMemoryCache(Config{GcDuration: 60, Load: LoadConfig{EarlyRefreshBeta: 1}}).(*memory)
+	for i := 0; i < maxDeltas+10; i++ {
+		c.GetOrElse(strconv.Itoa(i), warmUp, 60)
+	}
+	if len(c.loader.deltas) != maxDeltas {
+		t.Errorf("expect %d warm up durations, got %d", maxDeltas, len(c.loader.deltas))
+	}
+	c.GetOrElse("key", warmUp, 60)
+	c.Delete("key")
+	if _, ok := c.loader.deltas["key"]; ok {
+		t.Error("warm up duration of deleted key is kept")
+	}
+}
+
+func TestBoundedMemoryCache(t *testing.T) {
+	var evictedKeys []string
+	onEvict := func(key string, value interface{}, reason EvictReason) {
+		evictedKeys = append(evictedKeys, key+":"+reason.String())
+	}
+	for policy, want := range map[Policy]string{LRU: "b", LFU: "b", FIFO: "a"} {
+		evictedKeys = nil
+		c := NewBoundedMemoryCache(BoundedConfig{Policy: policy, MaxEntries: 2, Shards: 1, OnEvict: onEvict})
+		c.Set("a", 1, 0)
+		c.Set("b", 2, 0)
+		// a is used more recently and more frequently than b
+		c.Get("a")
+		c.Set("c", 3, 0)
+		if len(evictedKeys) != 1 || evictedKeys[0] != want+":capacity" {
+			t.Errorf("policy %d: evicted %v, want %s", policy, evictedKeys, want)
+		}
+		if c.IsExist(want) || !c.IsExist("c") {
+			t.Errorf("policy %d: wrong entries", policy)
+		}
+	}
+
+	c := NewBoundedMemoryCache(BoundedConfig{MaxBytes: 8, Shards: 1})
+	c.Set("a", "1234", 0)
+	c.Set("b", "1234", 0)
+	if c.IsExist("a") || !c.IsExist("b") {
+		t.Error("max bytes is not respected")
+	}
+
+	evictedKeys = nil
+	c = NewBoundedMemoryCache(BoundedConfig{MaxEntries: 100, OnEvict: onEvict})
+	c.Set("counter", int64(1), 1)
+	if err := c.Incr("counter"); err != nil || c.Get("counter") != int64(2) {
+		t.Errorf("incr failed: %v", err)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	if c.Get("counter") != nil || len(evictedKeys) != 1 || evictedKeys[0] != "counter:expired" {
+		t.Errorf("expired entry is returned, evicted %v", evictedKeys)
+	}
+
+	// entry larger than limit is rejected and replaces nothing
+	c = NewBoundedMemoryCache(BoundedConfig{MaxBytes: 8, Shards: 1})
+	c.Set("a", "1234", 0)
+	c.Set("a", "123456789", 0)
+	if c.IsExist("a") || c.Stats().Rejections != 1 || c.Stats().Evictions != 0 {
+		t.Errorf("oversized entry is not rejected: %+v", c.Stats())
+	}
+
+	// limits of shards add up to configured limit
+	c = NewBoundedMemoryCache(BoundedConfig{MaxEntries: 100})
+	for i := 0; i < 1000; i++ {
+		c.Set(strconv.Itoa(i), i, 0)
+	}
+	if size := c.Stats().Size; size != 100 {
+		t.Errorf("expect 100 entries, got %d", size)
+	}
+
+	// size of structured value is estimated without encoding it
+	type profile struct {
+		Name  string
+		Roles []string
+	}
+	if size := sizeOf("k", &profile{Name: strings.Repeat("x", 100), Roles: []string{"admin"}}); size < 106 || size > 200 {
+		t.Errorf("wrong size estimate %d", size)
+	}
+
+	// frequency of entry which is no longer used fades
+	lfu := newEvictionPolicy(LFU)
+	old, recent := &boundedEntry{key: "old"}, &boundedEntry{key: "recent"}
+	lfu.add(old)
+	for i := 0; i < 200; i++ {
+		lfu.access(old)
+	}
+	lfu.add(recent)
+	for i := 0; i < 50; i++ {
+		lfu.access(recent)
+	}
+	if victim := lfu.victim(); victim != old {
+		t.Errorf("lfu frequencies are not aged, victim %s", victim.key)
+	}
+
+	// tags are cleared with entries
+	c = NewBoundedMemoryCache(BoundedConfig{MaxEntries: 10})
+	c.(Tagger).SetWithTags("user:1", "denny", 0, "users")
+	c.ClearAll()
+	c.Set("user:1", "jenny", 0)
+	_ = c.(Tagger).InvalidateTags("users")
+	if c.Get("user:1") != "jenny" {
+		t.Error("tags survive ClearAll")
+	}
+}
+
+func TestBoundedGetOrElseStale(t *testing.T) {
+	var (
+		c = NewBoundedMemoryCache(BoundedConfig{
+			Config:     Config{Load: LoadConfig{StaleWhileRevalidate: time.Minute}},
+			MaxEntries: 10,
+		})
+		version int32
+		warmUp  = func(key string) interface{} {
+			return atomic.AddInt32(&version, 1)
+		}
+	)
+	if v := c.GetOrElse("key", warmUp, 1); v != int32(1) {
+		t.Fatalf("wrong value %v", v)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	// stale value is served while it's reloaded in background, plain Get does not return it
+	if v := c.Get("key"); v != nil {
+		t.Errorf("expired value is returned by Get: %v", v)
+	}
+	if v := c.GetOrElse("key", warmUp, 1); v != int32(1) {
+		t.Errorf("expect stale value, got %v", v)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if v := c.GetOrElse("key", warmUp, 1); v != int32(2) {
+		t.Errorf("expect refreshed value, got %v", v)
+	}
+}
+
+func TestMemoryTTL(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	for name, c := range map[string]Cache{
+		"memory":  NewMemoryCache(Config{GcDuration: 60}),
+		"bounded": NewBoundedMemoryCache(BoundedConfig{}),
+		"redis":   NewRedis(server.Addr(), ""),
+	} {
+		e := c.(Expirer)
+		e.SetWithTTL("counter", int64(1), 200*time.Millisecond)
+		if err := c.Incr("counter"); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		// counter keeps its deadline
+		if ttl, err := e.TTL("counter"); err != nil || ttl <= 0 || ttl > 200*time.Millisecond {
+			t.Errorf("%s: wrong ttl %v, %v", name, ttl, err)
+		}
+		if err := e.Persist("counter"); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if ttl, _ := e.TTL("counter"); ttl != NoExpiration {
+			t.Errorf("%s: expect no expiration, got %v", name, ttl)
+		}
+		if err := e.Expire("counter", 100*time.Millisecond); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if _, err := e.TTL("missing"); err != ValueNotExistError {
+			t.Errorf("%s: expect miss, got %v", name, err)
+		}
+		if name == "redis" {
+			server.FastForward(150 * time.Millisecond)
+		} else {
+			time.Sleep(150 * time.Millisecond)
+		}
+		// expired value is not returned before gc runs, Incr starts counter again
+		if c.Get("counter") != nil {
+			t.Errorf("%s: expired value is returned", name)
+		}
+		if err := c.Incr("counter"); err != nil || fmt.Sprint(c.Get("counter")) != "1" {
+			t.Errorf("%s: expired counter is not restarted: %v, %v", name, c.Get("counter"), err)
+		}
+		if ttl, _ := e.TTL("counter"); ttl != NoExpiration {
+			t.Errorf("%s: restarted counter expires: %v", name, ttl)
+		}
+	}
+
+	c := NewMemoryCache(Config{GcDuration: 60})
+	c.Set("a", "denny", 0)
+	if values := c.GetMulti([]string{"a", "b"}); values[0] != "denny" || values[1] != nil {
+		t.Errorf("wrong values %v", values)
+	}
+}
+
+func TestMemoryConcurrentUpdate(t *testing.T) {
+	for name, c := range map[string]Cache{
+		"memory":  NewMemoryCache(Config{GcDuration: 60}),
+		"bounded": NewBoundedMemoryCache(BoundedConfig{}),
+	} {
+		e := c.(Expirer)
+		e.SetWithTTL("counter", int64(0), time.Minute)
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					_ = c.Incr("counter")
+					_ = e.Expire("counter", time.Minute)
+					_ = e.Persist("counter")
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					_ = c.Get("counter")
+					_, _ = e.TTL("counter")
+					_ = c.GetOrElse("counter", func(string) interface{} { return int64(0) })
+				}
+			}()
+		}
+		wg.Wait()
+		if v := c.Get("counter"); v != int64(400) {
+			t.Errorf("%s: expect 400, got %v", name, v)
+		}
+	}
+}
+
+func TestTieredCache(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	addr := server.Addr()
+	newReplica := func() Cache {
+		c, err := NewTieredCache(TieredConfig{Remote: NewRedis(addr, ""), LocalTTL: time.Minute})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	a, b := newReplica(), newReplica()
+	defer a.(*tiered).Close()
+	defer b.(*tiered).Close()
+
+	a.Set("name", "denny", 0)
+	if v := b.Get("name"); v != "denny" {
+		t.Fatalf("wrong value %v", v)
+	}
+	// value is served by local cache of b
+	server.Set("name", "jenny")
+	if v := b.Get("name"); v != "denny" {
+		t.Errorf("expect local value, got %v", v)
+	}
+
+	a.Set("name", "benny", 0)
+	time.Sleep(50 * time.Millisecond)
+	if v := b.Get("name"); v != "benny" {
+		t.Errorf("local copy is not invalidated, got %v", v)
+	}
+
+	a.Delete("name")
+	time.Sleep(50 * time.Millisecond)
+	if v := b.Get("name"); v != nil {
+		t.Errorf("deleted value is returned: %v", v)
+	}
+
+	if _, err := NewTieredCache(TieredConfig{Remote: NewMemoryCache(Config{GcDuration: 60})}); err != RemoteNotRedisError {
+		t.Errorf("expect remote error, got %v", err)
+	}
+
+	// replica created while redis is down subscribes once it's back
+	server.Close()
+	late := newReplica()
+	defer late.(*tiered).Close()
+	if err := server.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	late.Set("name", "denny", 0)
+	deadline := time.Now().Add(3 * time.Second)
+	for late.Get("name") != "benny" && time.Now().Before(deadline) {
+		a.Set("name", "benny", 0)
+		time.Sleep(50 * time.Millisecond)
+	}
+	if v := late.Get("name"); v != "benny" {
+		t.Errorf("local copy is not invalidated after reconnect, got %v", v)
+	}
+}
+
+func TestTieredGetOrElse(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	newReplica := func() Cache {
+		remote := NewRedisWithConfig(RedisConfig{
+			Options: RedisOptions{Addr: server.Addr()},
+			Load:    LoadConfig{StaleWhileRevalidate: time.Minute},
+		})
+		c, err := NewTieredCache(TieredConfig{Remote: remote, LocalTTL: time.Minute})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	var (
+		a, b, c = newReplica(), newReplica(), newReplica()
+		version int32
+		warmUp  = func(key string) interface{} {
+			return atomic.AddInt32(&version, 1)
+		}
+	)
+	defer a.(*tiered).Close()
+	defer b.(*tiered).Close()
+	defer c.(*tiered).Close()
+
+	// loaded and cached values have the type of values read from redis
+	if v := a.GetOrElse("version", warmUp, 10); v != "1" {
+		t.Fatalf("wrong value %v", v)
+	}
+	if v := a.Get("version"); v != "1" {
+		t.Errorf("wrong local value %v", v)
+	}
+	if v := b.GetOrElse("version", warmUp, 10); v != "1" {
+		t.Errorf("wrong remote value %v", v)
+	}
+
+	// c serves stale value and refreshes it in background, local copy of b is evicted
+	server.FastForward(11 * time.Second)
+	if v := c.GetOrElse("version", warmUp, 10); v != "1" {
+		t.Errorf("expect stale value, got %v", v)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if v := b.Get("version"); v != "2" {
+		t.Errorf("local copy is not invalidated after refresh, got %v", v)
+	}
+	if v := c.Get("version"); v != "2" {
+		t.Errorf("refreshed value is not cached, got %v", v)
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+	var (
+		c      = NewBoundedMemoryCache(BoundedConfig{MaxEntries: 2, Shards: 1})
+		warmUp = func(key string) interface{} {
+			if key == "user:404" {
+				return nil
+			}
+			return key
+		}
+	)
+	c.GetOrElse("user:1", warmUp, 60)
+	c.GetOrElse("user:1", warmUp, 60)
+	c.GetOrElse("user:404", warmUp, 60)
+	c.Get("session")
+	c.Set("a", 1, 0)
+	c.Set("b", 2, 0)
+
+	s := c.Stats()
+	if s.Hits != 1 || s.Misses != 3 || s.Loads != 2 || s.LoadErrors != 1 || s.Evictions != 1 || s.Size != 2 {
+		t.Errorf("wrong stats %+v", s)
+	}
+	if user := s.Namespaces["user"]; user.Hits != 1 || user.Misses != 2 || user.Loads != 2 {
+		t.Errorf("wrong namespace stats %+v", user)
+	}
+	if s.HitRatio() != 0.25 {
+		t.Errorf("wrong hit ratio %v", s.HitRatio())
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewCollector(map[string]Cache{"users": c}))
+	families, err := registry.Gather()
+	if err != nil || len(families) != 8 {
+		t.Errorf("wrong metrics %d, %v", len(families), err)
+	}
+}
+
+func TestNamespaceAndTags(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	var (
+		shared  = NewRedis(server.Addr(), "")
+		flushed = NewRedisWithConfig(RedisConfig{Options: RedisOptions{Addr: server.Addr()}, FlushDB: true})
+	)
+	tiered, err := NewTieredCache(TieredConfig{Remote: flushed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, c := range map[string]Cache{
+		"memory":  NewMemoryCache(Config{GcDuration: 60}),
+		"bounded": NewBoundedMemoryCache(BoundedConfig{}),
+		"redis":   flushed,
+		"tiered":  tiered,
+	} {
+		var (
+			users  = WithNamespace(c, "user")
+			orders = WithNamespace(c, "order")
+		)
+		users.Set("42", "denny", 0)
+		orders.Set("42", "book", 0)
+		c.Set("shared", "value", 0)
+		if v := c.Get("user:42"); v != "denny" {
+			t.Errorf("%s: key is not prefixed, got %v", name, v)
+		}
+
+		users.ClearAll()
+		if users.Get("42") != nil || orders.Get("42") != "book" || c.Get("shared") != "value" {
+			t.Errorf("%s: clear all is not limited to namespace", name)
+		}
+
+		users.(Tagger).SetWithTags("42", "denny", time.Minute, "user:42")
+		orders.(Tagger).SetWithTags("1", "pen", 0, "user:42")
+		orders.(Tagger).SetWithTags("2", "cup", 0, "user:7")
+		if err := users.(Tagger).InvalidateTags("user:42"); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if users.Get("42") != nil || orders.Get("1") != nil || orders.Get("2") != "cup" {
+			t.Errorf("%s: tagged keys are not invalidated", name)
+		}
+		c.ClearAll()
+	}
+
+	// database of redis cache may be shared, it's only flushed when allowed
+	shared.Set("shared", "value", 0)
+	shared.ClearAll()
+	if shared.Get("shared") != "value" {
+		t.Error("redis database is flushed without FlushDB")
+	}
+	flushed.ClearAll()
+	if shared.Get("shared") != nil {
+		t.Error("redis database is not flushed with FlushDB")
+	}
+}
+
+func TestBatchOperations(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	for name, c := range map[string]Cache{
+		"memory":    NewMemoryCache(Config{GcDuration: 60}),
+		"bounded":   NewBoundedMemoryCache(BoundedConfig{}),
+		"redis":     NewRedis(server.Addr(), ""),
+		"cluster":   NewRedisWithOptions(RedisOptions{ClusterAddrs: []string{server.Addr()}}),
+		"namespace": WithNamespace(NewMemoryCache(Config{GcDuration: 60}), "batch"),
+	} {
+		c.SetMulti(map[string]Item{
+			"a":       {Value: "1"},
+			"b":       {Value: "2", TTL: time.Minute},
+			"counter": {Value: int64(10)},
+		})
+		if v, err := c.IncrBy("counter", 5); err != nil || v != 15 {
+			t.Errorf("%s: incr by got %v, %v", name, v, err)
+		}
+		if v, err := c.DecrBy("counter", 20); err != nil || v != -5 {
+			t.Errorf("%s: decr by got %v, %v", name, v, err)
+		}
+		// every backend creates missing counter
+		if v, err := c.IncrBy("visits", 3); err != nil || v != 3 {
+			t.Errorf("%s: incr by of missing key got %v, %v", name, v, err)
+		}
+		if v, err := c.DecrBy("stock", 2); err != nil || v != -2 {
+			t.Errorf("%s: decr by of missing key got %v, %v", name, v, err)
+		}
+		c.DeleteMulti([]string{"visits", "stock"})
+
+		var requested []string
+		values := c.GetOrElseMulti([]string{"a", "c", "d"}, func(keys []string) map[string]interface{} {
+			requested = keys
+			return map[string]interface{}{"c": "3"}
+		}, 60)
+		if len(requested) != 2 || values[0] != "1" || values[1] != "3" || values[2] != nil {
+			t.Errorf("%s: wrong values %v, loaded %v", name, values, requested)
+		}
+		if v := c.Get("c"); v != "3" {
+			t.Errorf("%s: loaded value is not stored: %v", name, v)
+		}
+		values, err := c.(ContextCache).GetMultiContext(context.Background(), []string{"a", "d"})
+		if err != nil || len(values) != 2 || values[0] != "1" || values[1] != nil {
+			t.Errorf("%s: wrong values %v, %v", name, values, err)
+		}
+
+		c.DeleteMulti([]string{"a", "b", "c"})
+		if c.IsExist("a") || c.IsExist("b") || c.IsExist("c") {
+			t.Errorf("%s: keys are not deleted", name)
+		}
+	}
+
+	// redis failure is reported instead of being taken as misses
+	c := NewRedis(server.Addr(), "").(ContextCache)
+	server.Close()
+	var backendErr *BackendError
+	if _, err := c.GetMultiContext(context.Background(), []string{"a"}); !errors.As(err, &backendErr) {
+		t.Errorf("expect backend error, got %v", err)
+	}
+}
+
+func TestLocker(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	var (
+		ctx  = context.Background()
+		opts = LockOptions{TTL: 150 * time.Millisecond, AutoExtend: true}
+	)
+	for name, locker := range map[string]Locker{
+		"memory": NewMemoryLocker(opts),
+		"redis":  NewRedisLocker(NewRedis(server.Addr(), ""), opts),
+	} {
+		first, err := locker.TryLock(ctx, "job")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, err := locker.TryLock(ctx, "job"); err != LockNotObtainedError {
+			t.Errorf("%s: expect lock is held, got %v", name, err)
+		}
+		// lease outlives its ttl while it's extended, miniredis ttl does not pass by itself
+		time.Sleep(300 * time.Millisecond)
+		timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		if _, err := locker.Lock(timeout, "job"); err != context.DeadlineExceeded {
+			t.Errorf("%s: expect timeout, got %v", name, err)
+		}
+		cancel()
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			_ = first.Release(ctx)
+		}()
+		wait, cancel := context.WithTimeout(ctx, 2*time.Second)
+		second, err := locker.Lock(wait, "job")
+		cancel()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if second.Token() <= first.Token() {
+			t.Errorf("%s: fencing token does not increase: %d, %d", name, first.Token(), second.Token())
+		}
+		select {
+		case <-first.Done():
+		default:
+			t.Errorf("%s: released lease is not done", name)
+		}
+		if err := first.Release(ctx); err != LockNotHeldError {
+			t.Errorf("%s: released lock of other holder: %v", name, err)
+		}
+		if err := second.Release(ctx); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+// unreachableLockBackend grants locks but can not extend them, like redis which went away
+type unreachableLockBackend struct {
+	*memoryLockBackend
+}
+
+func (b unreachableLockBackend) extend(ctx context.Context, key, id string, ttl time.Duration) (bool, error) {
+	return false, errors.New("connection refused")
+}
+
+func TestLeaseLost(t *testing.T) {
+	locker := newLocker(unreachableLockBackend{&memoryLockBackend{
+		locks:  make(map[string]memoryLock),
+		fences: make(map[string]int64),
+	}}, LockOptions{TTL: 150 * time.Millisecond, AutoExtend: true})
+	start := time.Now()
+	lease, err := locker.TryLock(context.Background(), "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-lease.Done():
+		if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+			t.Errorf("lease is lost before its ttl: %v", elapsed)
+		}
+	case <-time.After(time.Second):
+		t.Error("lease which can not be extended is not done")
+	}
+}
+
+func TestLockerRetryMax(t *testing.T) {
+	locker := newLocker(nil, LockOptions{RetryMin: 2 * time.Second})
+	if locker.opts.RetryMax != 2*time.Second {
+		t.Errorf("expect RetryMax defaults to RetryMin, got %v", locker.opts.RetryMax)
+	}
+}
@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec converts values to bytes stored in cache and back
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	JSONCodec    Codec = jsonCodec{}
+	GobCodec     Codec = gobCodec{}
+	ProtoCodec   Codec = protoCodec{}
+	MsgpackCodec Codec = msgpackCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// protoCodec encodes protobuf messages, values must implement proto.Message
+type protoCodec struct{}
+
+func (protoCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T is not a proto message", InvalidValueTypeError, v)
+	}
+	return proto.Marshal(m)
+}
+
+func (protoCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("%w: %T is not a proto message", InvalidValueTypeError, v)
+	}
+	return proto.Unmarshal(data, m)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return msgpack.Unmarshal(data, v)
+}
@@ -0,0 +1,171 @@
+package cache
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// LoadConfig controls how GetOrElse loads missing values.
+// Concurrent misses of same key are always coalesced so one warm up function runs per key per process
+type LoadConfig struct {
+	// StaleWhileRevalidate keeps serving expired value for this long while it is reloaded in background
+	StaleWhileRevalidate time.Duration
+	// EarlyRefreshBeta enables probabilistic early refresh (XFetch) of values about to expire,
+	// the larger it is the earlier values are refreshed, 1 is a good default, 0 disables it
+	EarlyRefreshBeta float64
+	// LockTTL enables distributed loading lock on redis so one warm up function runs per key cluster-wide,
+	// it should be longer than warm up function takes
+	LockTTL time.Duration
+	// LockWait is how long callers which do not hold the lock wait for value loaded by lock holder,
+	// warm up function is called locally when it passes, default is LockTTL
+	LockWait time.Duration
+}
+
+// flightCall is an in-flight or completed warm up call
+type flightCall struct {
+	wg  sync.WaitGroup
+	val interface{}
+}
+
+// flightGroup coalesces concurrent calls with same key
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// do runs fn once for concurrent callers of the same key, they all receive its result
+func (g *flightGroup) do(key string, fn func() interface{}) interface{} {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		call.wg.Wait()
+		return call.val
+	}
+	call := &flightCall{}
+	call.wg.Add(1)
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		call.wg.Done()
+	}()
+	call.val = fn()
+	return call.val
+}
+
+// inFlight reports whether a call of key is running
+func (g *flightGroup) inFlight(key string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	_, ok := g.calls[key]
+	return ok
+}
+
+// maxDeltas bounds number of keys whose warm up duration is remembered for early refresh,
+// an arbitrary key is forgotten when it's reached and early refresh of it falls back to 1ms
+const maxDeltas = 10000
+
+// loader is shared by backends to implement GetOrElse loading behaviour
+type loader struct {
+	cfg   LoadConfig
+	stats *recorder
+	group flightGroup
+	mu    sync.Mutex
+	// deltas holds duration of last warm up of keys, it's only kept when early refresh is enabled
+	deltas map[string]time.Duration
+}
+
+// load runs fn once per key for concurrent callers
+func (l *loader) load(key string, fn func() interface{}) interface{} {
+	return l.group.do(key, func() interface{} {
+		start := time.Now()
+		v := fn()
+		elapsed := time.Since(start)
+		if l.cfg.EarlyRefreshBeta > 0 && v != nil {
+			l.remember(key, elapsed)
+		}
+		if l.stats != nil {
+			l.stats.load(key, elapsed, v == nil)
+		}
+		return v
+	})
+}
+
+func (l *loader) remember(key string, delta time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.deltas == nil {
+		l.deltas = make(map[string]time.Duration)
+	}
+	if _, ok := l.deltas[key]; !ok && len(l.deltas) >= maxDeltas {
+		for k := range l.deltas {
+			delete(l.deltas, k)
+			break
+		}
+	}
+	l.deltas[key] = delta
+}
+
+// forget drops warm up duration of keys which are deleted or expired
+func (l *loader) forget(keys ...string) {
+	if l.cfg.EarlyRefreshBeta <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, k := range keys {
+		delete(l.deltas, k)
+	}
+}
+
+// reset drops every remembered warm up duration
+func (l *loader) reset() {
+	l.mu.Lock()
+	l.deltas = nil
+	l.mu.Unlock()
+}
+
+// refresh reloads key in background unless it's being loaded already
+func (l *loader) refresh(key string, fn func() interface{}) {
+	if l.group.inFlight(key) {
+		return
+	}
+	go l.load(key, fn)
+}
+
+// stale reports whether value expired for given duration can still be served while reloading
+func (l *loader) stale(expired time.Duration) bool {
+	return expired <= l.cfg.StaleWhileRevalidate
+}
+
+// refreshEarly decides whether value which expires after remaining should be refreshed now,
+// probability grows as expiry comes closer and as warm up function gets slower
+func (l *loader) refreshEarly(key string, remaining time.Duration) bool {
+	if l.cfg.EarlyRefreshBeta <= 0 {
+		return false
+	}
+	delta := time.Millisecond
+	l.mu.Lock()
+	if v, ok := l.deltas[key]; ok {
+		delta = v
+	}
+	l.mu.Unlock()
+	gap := float64(delta) * l.cfg.EarlyRefreshBeta * -math.Log(rand.Float64())
+	return gap >= float64(remaining)
+}
+
+// lockWait returns how long caller waits for value loaded by distributed lock holder
+func (l *loader) lockWait() time.Duration {
+	if l.cfg.LockWait > 0 {
+		return l.cfg.LockWait
+	}
+	return l.cfg.LockTTL
+}
@@ -0,0 +1,330 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	redisCli "github.com/go-redis/redis"
+	"github.com/google/uuid"
+)
+
+var (
+	// LockNotObtainedError is returned by TryLock when lock is held by other
+	LockNotObtainedError = errors.New("lock is held by other")
+	// LockNotHeldError is returned when lease expired or lock was released
+	LockNotHeldError = errors.New("lock is not held")
+)
+
+// LockOptions configures locks created by locker
+type LockOptions struct {
+	// TTL is lease duration, lock is released automatically when holder does not extend it, default is 10 seconds
+	TTL time.Duration
+	// AutoExtend extends lease every TTL/3 while lock is held
+	AutoExtend bool
+	// RetryMin and RetryMax bound exponential backoff of Lock, default is 10ms and 1s (or RetryMin when it's larger)
+	RetryMin time.Duration
+	RetryMax time.Duration
+}
+
+// Locker acquires distributed locks
+type Locker interface {
+	// TryLock acquires lock of key once, LockNotObtainedError is returned when it's held by other
+	TryLock(ctx context.Context, key string) (Lease, error)
+	// Lock acquires lock of key, retrying with backoff until ctx is done
+	Lock(ctx context.Context, key string) (Lease, error)
+}
+
+// Lease is held lock
+type Lease interface {
+	Key() string
+	// Token is fencing token, it increases every time lock of key is acquired so storage
+	// guarded by lock can reject writes of holder whose lease expired
+	Token() int64
+	// Extend extends lease to given ttl from now
+	Extend(ctx context.Context, ttl time.Duration) error
+	// Release releases lock if it's still held
+	Release(ctx context.Context) error
+	// Done is closed when lock is released or lost, eg: auto extension fails
+	Done() <-chan struct{}
+}
+
+// lockBackend stores locks, id identifies holder
+type lockBackend interface {
+	acquire(ctx context.Context, key, id string, ttl time.Duration) (token int64, ok bool, err error)
+	extend(ctx context.Context, key, id string, ttl time.Duration) (bool, error)
+	release(ctx context.Context, key, id string) (bool, error)
+}
+
+type locker struct {
+	backend lockBackend
+	opts    LockOptions
+}
+
+func newLocker(backend lockBackend, opts LockOptions) *locker {
+	if opts.TTL <= 0 {
+		opts.TTL = 10 * time.Second
+	}
+	if opts.RetryMin <= 0 {
+		opts.RetryMin = 10 * time.Millisecond
+	}
+	if opts.RetryMax <= 0 {
+		opts.RetryMax = time.Second
+	}
+	if opts.RetryMax < opts.RetryMin {
+		opts.RetryMax = opts.RetryMin
+	}
+	return &locker{backend: backend, opts: opts}
+}
+
+func (l *locker) TryLock(ctx context.Context, key string) (Lease, error) {
+	id, start := uuid.New().String(), time.Now()
+	token, ok, err := l.backend.acquire(ctx, key, id, l.opts.TTL)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, LockNotObtainedError
+	}
+	lease := &lease{
+		locker: l,
+		key:    key,
+		id:     id,
+		token:  token,
+		done:   make(chan struct{}),
+	}
+	if l.opts.AutoExtend {
+		go lease.keepAlive(start)
+	}
+	return lease, nil
+}
+
+func (l *locker) Lock(ctx context.Context, key string) (Lease, error) {
+	backoff := l.opts.RetryMin
+	for {
+		lease, err := l.TryLock(ctx, key)
+		if err != LockNotObtainedError {
+			return lease, err
+		}
+		// full jitter so waiting processes do not retry at the same time
+		wait := time.Duration(rand.Int63n(int64(backoff))) + 1
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		if backoff *= 2; backoff > l.opts.RetryMax {
+			backoff = l.opts.RetryMax
+		}
+	}
+}
+
+type lease struct {
+	locker *locker
+	key    string
+	id     string
+	token  int64
+	once   sync.Once
+	done   chan struct{}
+}
+
+func (l *lease) Key() string {
+	return l.key
+}
+
+func (l *lease) Token() int64 {
+	return l.token
+}
+
+func (l *lease) Done() <-chan struct{} {
+	return l.done
+}
+
+func (l *lease) close() {
+	l.once.Do(func() {
+		close(l.done)
+	})
+}
+
+func (l *lease) Extend(ctx context.Context, ttl time.Duration) error {
+	ok, err := l.locker.backend.extend(ctx, l.key, l.id, ttl)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		l.close()
+		return LockNotHeldError
+	}
+	return nil
+}
+
+func (l *lease) Release(ctx context.Context) error {
+	defer l.close()
+	ok, err := l.locker.backend.release(ctx, l.key, l.id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return LockNotHeldError
+	}
+	return nil
+}
+
+// keepAlive extends lease every TTL/3 until it's released or lost, extended is when lease
+// was last known to be valid for TTL, once TTL passes since then without successful extension,
+// lock may be held by other so lease is considered lost
+func (l *lease) keepAlive(extended time.Time) {
+	ttl := l.locker.opts.TTL
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+			start := time.Now()
+			ctx, cancel := context.WithTimeout(context.Background(), ttl/3)
+			err := l.Extend(ctx, ttl)
+			cancel()
+			switch {
+			case err == nil:
+				extended = start
+			case err == LockNotHeldError:
+				return
+			case time.Since(extended) >= ttl:
+				// transient failures lasted until lease expired
+				l.close()
+				return
+			}
+		}
+	}
+}
+
+// acquireLockScript sets lock when it's free and increases fencing counter,
+// both keys share hash tag so they live in the same cluster slot
+var acquireLockScript = redisCli.NewScript(`
+if redis.call("set", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return redis.call("incr", KEYS[2])
+end
+return 0`)
+
+// extendLockScript extends lock only when it's still held by caller
+var extendLockScript = redisCli.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0`)
+
+type redisLockBackend struct {
+	redis *redis
+}
+
+func lockKeys(key string) (lock, fence string) {
+	lock = "denny:lock:{" + key + "}"
+	return lock, lock + ":fence"
+}
+
+func (b *redisLockBackend) acquire(ctx context.Context, key, id string, ttl time.Duration) (int64, bool, error) {
+	lock, fence := lockKeys(key)
+	token, err := acquireLockScript.Run(b.redis.withContext(ctx), []string{lock, fence}, id, int64(ttl/time.Millisecond)).Int64()
+	if err != nil {
+		return 0, false, &BackendError{Op: "lock", Key: key, Err: err}
+	}
+	return token, token > 0, nil
+}
+
+func (b *redisLockBackend) extend(ctx context.Context, key, id string, ttl time.Duration) (bool, error) {
+	lock, _ := lockKeys(key)
+	n, err := extendLockScript.Run(b.redis.withContext(ctx), []string{lock}, id, int64(ttl/time.Millisecond)).Int64()
+	if err != nil {
+		return false, &BackendError{Op: "extend lock", Key: key, Err: err}
+	}
+	return n > 0, nil
+}
+
+func (b *redisLockBackend) release(ctx context.Context, key, id string) (bool, error) {
+	lock, _ := lockKeys(key)
+	n, err := releaseLockScript.Run(b.redis.withContext(ctx), []string{lock}, id).Int64()
+	if err != nil {
+		return false, &BackendError{Op: "unlock", Key: key, Err: err}
+	}
+	return n > 0, nil
+}
+
+// NewRedisLocker creates locker storing locks in redis with SET NX PX, it panics when cache is not redis cache
+func NewRedisLocker(c Cache, opts LockOptions) Locker {
+	r, ok := c.(*redis)
+	if !ok {
+		panic("cache: redis locker requires redis cache")
+	}
+	return newLocker(&redisLockBackend{redis: r}, opts)
+}
+
+type memoryLock struct {
+	id       string
+	deadline time.Time
+}
+
+// memoryLockBackend keeps locks in process, it's meant for tests and single process deployment
+type memoryLockBackend struct {
+	sync.Mutex
+	locks  map[string]memoryLock
+	fences map[string]int64
+}
+
+func (b *memoryLockBackend) held(key, id string) bool {
+	l, ok := b.locks[key]
+	return ok && l.id == id && time.Now().Before(l.deadline)
+}
+
+func (b *memoryLockBackend) acquire(ctx context.Context, key, id string, ttl time.Duration) (int64, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, false, err
+	}
+	b.Lock()
+	defer b.Unlock()
+	if l, ok := b.locks[key]; ok && time.Now().Before(l.deadline) {
+		return 0, false, nil
+	}
+	b.locks[key] = memoryLock{id: id, deadline: time.Now().Add(ttl)}
+	b.fences[key]++
+	return b.fences[key], true, nil
+}
+
+func (b *memoryLockBackend) extend(ctx context.Context, key, id string, ttl time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	b.Lock()
+	defer b.Unlock()
+	if !b.held(key, id) {
+		return false, nil
+	}
+	b.locks[key] = memoryLock{id: id, deadline: time.Now().Add(ttl)}
+	return true, nil
+}
+
+func (b *memoryLockBackend) release(ctx context.Context, key, id string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	b.Lock()
+	defer b.Unlock()
+	if !b.held(key, id) {
+		return false, nil
+	}
+	delete(b.locks, key)
+	return true, nil
+}
+
+// NewMemoryLocker creates locker keeping locks in process, it's meant for tests
+func NewMemoryLocker(opts LockOptions) Locker {
+	return newLocker(&memoryLockBackend{
+		locks:  make(map[string]memoryLock),
+		fences: make(map[string]int64),
+	}, opts)
+}
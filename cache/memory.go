@@ -1,176 +1,365 @@
 package cache
 
 import (
+	"context"
+	"strings"
 	"sync"
 	"time"
 )
 
 type memory struct {
-	count int64
 	sync.RWMutex
-	storage *sync.Map
+	items  map[string]*item
+	loader *loader
+	stats  *recorder
+	tags   tagIndex
 }
 
+// item is never changed after it's stored, readers use it after releasing lock,
+// so writers replace it instead
 type item struct {
-	expire      time.Duration
-	createdTime time.Time
-	value       interface{}
+	value interface{}
+	// deadline is zero when item never expires
+	deadline time.Time
 }
 
-func (i *item) life() int64 {
-	if i.expire == 0 {
-		return 0
+func newItem(value interface{}, ttl time.Duration) *item {
+	i := &item{value: value}
+	if ttl > 0 {
+		i.deadline = time.Now().Add(ttl)
 	}
-	return int64(time.Now().Sub(i.createdTime).Seconds())
+	return i
 }
 
-func (i *item) isExpire() bool {
-	return time.Now().Sub(i.createdTime) > i.expire
+// remaining returns duration until item expires, it's negative when item already expired
+func (i *item) remaining(now time.Time) time.Duration {
+	if i.deadline.IsZero() {
+		return NoExpiration
+	}
+	return i.deadline.Sub(now)
+}
+
+func (i *item) isExpire(now time.Time) bool {
+	return !i.deadline.IsZero() && !now.Before(i.deadline)
+}
+
+// peek returns item of key even when it's expired
+func (c *memory) peek(key string) (*item, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	v, ok := c.items[key]
+	return v, ok
 }
 
-// Get return value if key exist or nil if it does not
+// load returns item of key if it's not expired
+func (c *memory) load(key string) (*item, bool) {
+	v, ok := c.peek(key)
+	if !ok || v.isExpire(time.Now()) {
+		return nil, false
+	}
+	return v, true
+}
+
+// Get return value if key exist or nil if it does not, expired value is never returned
 func (c *memory) Get(key string) interface{} {
-	el, ok := c.storage.Load(key)
+	v, ok := c.load(key)
+	c.stats.hit(key, ok)
 	if ok {
-		v := el.(*item)
 		return v.value
 	}
 	return nil
 }
 
-// GetOrElse return value if it exists, else warmup using warmup function
+// GetOrElse return value if it exists, else warmup using warmup function,
+// concurrent misses of the same key share one warmup call
 func (c *memory) GetOrElse(key string, wuf func(key string) interface{}, expire ...int64) interface{} {
-	el, ok := c.storage.Load(key)
-	if ok {
-		v := el.(*item)
-		return v.value
+	var expired int64 = 0
+	if len(expire) > 0 {
+		expired = expire[0]
 	}
-	if v := wuf(key); v != nil {
-		var expired int64 = 0
-		if len(expire) > 0 {
-			expired = expire[0]
+	warmUp := func() interface{} {
+		if v := wuf(key); v != nil {
+			c.Set(key, v, expired)
+			return v
 		}
-		c.Set(key, v, expired)
-		return v
+		return nil
 	}
-	return nil
+	if v, ok := c.peek(key); ok {
+		remaining := v.remaining(time.Now())
+		switch {
+		case v.deadline.IsZero():
+			c.stats.hit(key, true)
+			return v.value
+		case remaining > 0:
+			if c.loader.refreshEarly(key, remaining) {
+				c.loader.refresh(key, warmUp)
+			}
+			c.stats.hit(key, true)
+			return v.value
+		case c.loader.stale(-remaining):
+			c.loader.refresh(key, warmUp)
+			c.stats.hit(key, true)
+			return v.value
+		}
+	}
+	c.stats.hit(key, false)
+	return c.loader.load(key, func() interface{} {
+		// value may be loaded by previous call while this one waited
+		if v, ok := c.load(key); ok {
+			return v.value
+		}
+		return warmUp()
+	})
 }
 
-// Set store key in sync map
+// Set store value, expire is in second, 0 means value never expires
 func (c *memory) Set(key string, val interface{}, expire int64) {
-	c.storage.Store(key, &item{
-		value:       val,
-		createdTime: time.Now(),
-		expire:      time.Duration(expire) * time.Second,
-	})
+	c.SetWithTTL(key, val, time.Duration(expire)*time.Second)
+}
+
+// SetWithTTL store value, 0 ttl means value never expires
+func (c *memory) SetWithTTL(key string, val interface{}, ttl time.Duration) {
+	v := newItem(val, ttl)
+	c.Lock()
+	c.items[key] = v
+	c.Unlock()
 }
 
-// Get multi will load all values with given keys
-// caller has to check request return value against nil befors using
-// as this call will not check key existence
+// GetMulti returns values of given keys, value of missing key is nil
 func (c *memory) GetMulti(keys []string) []interface{} {
-	var values []interface{}
-	for _, k := range keys {
-		el, _ := c.storage.Load(k)
-		v, ok := el.(*item)
-		if ok {
-			values = append(values, v)
-		} else {
-			values = append(values, nil)
-		}
+	values := make([]interface{}, len(keys))
+	for i, k := range keys {
+		values[i] = c.Get(k)
 	}
 	return values
 }
 
 // Delete delete key in map if it exists
 func (c *memory) Delete(key string) {
-	c.storage.Delete(key)
+	c.Lock()
+	delete(c.items, key)
+	c.Unlock()
+	c.loader.forget(key)
 }
 
-// Incr incr key in map if it exists
-func (c *memory) Incr(key string) error {
-	c.RLock()
-	defer c.RUnlock()
-	el, ok := c.storage.Load(key)
-	if !ok {
-		return ValueNotExistError
-	}
-
-	v, ok := el.(*item)
-	if !ok {
-		return InvalidValueTypeError
+// add changes int64 value of key by delta keeping its deadline,
+// missing key is created with value delta and no expiry as redis does
+func (c *memory) add(key string, delta int64) (int64, error) {
+	c.Lock()
+	defer c.Unlock()
+	v, ok := c.items[key]
+	if !ok || v.isExpire(time.Now()) {
+		c.items[key] = &item{value: delta}
+		return delta, nil
 	}
-
 	i, ok := v.value.(int64)
 	if !ok {
-		return InvalidValueTypeError
+		return 0, InvalidValueTypeError
 	}
+	c.items[key] = &item{value: i + delta, deadline: v.deadline}
+	return i + delta, nil
+}
 
-	c.Set(key, i+1, v.life())
-	return nil
+// Incr increases int64 value of key by one keeping its expiry
+func (c *memory) Incr(key string) error {
+	_, err := c.add(key, 1)
+	return err
 }
 
-// Incr incr key in map if it exists
+// Decr decreases int64 value of key by one keeping its expiry
 func (c *memory) Decr(key string) error {
+	_, err := c.add(key, -1)
+	return err
+}
+
+// IncrBy increases int64 value of key by delta keeping its expiry
+func (c *memory) IncrBy(key string, delta int64) (int64, error) {
+	return c.add(key, delta)
+}
+
+// DecrBy decreases int64 value of key by delta keeping its expiry
+func (c *memory) DecrBy(key string, delta int64) (int64, error) {
+	return c.add(key, -delta)
+}
+
+// SetMulti stores values under one lock
+func (c *memory) SetMulti(items map[string]Item) {
 	c.Lock()
 	defer c.Unlock()
-	el, ok := c.storage.Load(key)
-	if !ok {
-		return ValueNotExistError
+	for k, v := range items {
+		c.items[k] = newItem(v.Value, v.TTL)
 	}
+}
 
-	v, ok := el.(*item)
-	if !ok {
-		return InvalidValueTypeError
+// DeleteMulti deletes keys under one lock
+func (c *memory) DeleteMulti(keys []string) {
+	c.Lock()
+	defer c.Unlock()
+	for _, k := range keys {
+		delete(c.items, k)
 	}
+	c.loader.forget(keys...)
+}
 
-	i, ok := v.value.(int64)
+// GetOrElseMulti returns values of keys, missing ones are loaded by one loader call
+func (c *memory) GetOrElseMulti(keys []string, loader func(keys []string) map[string]interface{}, expire ...int64) []interface{} {
+	return getOrElseMulti(c, c.stats, keys, loader, expire...)
+}
+
+func (c *memory) IsExist(key string) bool {
+	_, ok := c.load(key)
+	return ok
+}
+
+func (c *memory) ClearAll() {
+	c.Lock()
+	c.items = make(map[string]*item)
+	c.Unlock()
+	c.tags.clear()
+	c.loader.reset()
+}
+
+// TTL returns remaining time to live of key, NoExpiration when key never expires
+func (c *memory) TTL(key string) (time.Duration, error) {
+	v, ok := c.load(key)
 	if !ok {
-		return InvalidValueTypeError
+		return 0, ValueNotExistError
 	}
+	return v.remaining(time.Now()), nil
+}
 
-	c.Set(key, i-1, v.life())
+// Expire sets time to live of key, non positive ttl deletes key
+func (c *memory) Expire(key string, ttl time.Duration) error {
+	c.Lock()
+	defer c.Unlock()
+	v, ok := c.items[key]
+	if !ok || v.isExpire(time.Now()) {
+		return ValueNotExistError
+	}
+	if ttl <= 0 {
+		delete(c.items, key)
+		return nil
+	}
+	c.items[key] = &item{value: v.value, deadline: time.Now().Add(ttl)}
 	return nil
 }
 
-func (c *memory) IsExist(key string) bool {
-	_, ok := c.storage.Load(key)
-	return ok
+// Persist removes expiry of key
+func (c *memory) Persist(key string) error {
+	c.Lock()
+	defer c.Unlock()
+	v, ok := c.items[key]
+	if !ok || v.isExpire(time.Now()) {
+		return ValueNotExistError
+	}
+	c.items[key] = &item{value: v.value}
+	return nil
 }
 
-func (c *memory) ClearAll() {
-	c.storage.Range(func(key, value interface{}) bool {
-		c.storage.Delete(key)
-		return true
-	})
+// SetWithTags stores value and attaches tags to key
+func (c *memory) SetWithTags(key string, val interface{}, ttl time.Duration, tags ...string) {
+	c.SetWithTTL(key, val, ttl)
+	c.tags.add(key, tags)
+}
+
+// InvalidateTags deletes every key attached to given tags
+func (c *memory) InvalidateTags(tags ...string) error {
+	for _, key := range c.tags.take(tags) {
+		c.Delete(key)
+	}
+	return nil
+}
+
+// deletePrefix deletes every key starting with prefix
+func (c *memory) deletePrefix(prefix string) error {
+	c.Lock()
+	defer c.Unlock()
+	for k := range c.items {
+		if strings.HasPrefix(k, prefix) {
+			delete(c.items, k)
+		}
+	}
+	return nil
 }
 
 func (c *memory) runGc(config Config) {
 	for {
 		<-time.After(time.Duration(config.GcDuration) * time.Second)
-		for _, k := range c.expires() {
-			c.Delete(k)
-		}
+		c.deleteExpired()
 	}
 }
 
-func (c *memory) expires() []string {
-	var keys []string
-	c.storage.Range(func(k, el interface{}) bool {
-		v := el.(*item)
-		if v.expire != 0 {
-			if v.isExpire() {
-				keys = append(keys, k.(string))
-			}
+// deleteExpired removes expired items, stale items are kept so GetOrElse can serve them while reloading
+func (c *memory) deleteExpired() {
+	now := time.Now()
+	c.Lock()
+	for k, v := range c.items {
+		if v.isExpire(now) && !c.loader.stale(-v.remaining(now)) {
+			delete(c.items, k)
+			c.stats.evict(k)
+			c.loader.forget(k)
 		}
-		return true
+	}
+	c.Unlock()
+	c.tags.prune(func(key string) bool {
+		_, ok := c.peek(key)
+		return ok
 	})
-	return keys
+}
+
+// GetContext returns value or ValueNotExistError when key does not exist
+func (c *memory) GetContext(ctx context.Context, key string) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	v, ok := c.load(key)
+	c.stats.hit(key, ok)
+	if !ok {
+		return nil, ValueNotExistError
+	}
+	return v.value, nil
+}
+
+// GetMultiContext returns values of keys, values of missing keys are nil
+func (c *memory) GetMultiContext(ctx context.Context, keys []string) ([]interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.GetMulti(keys), nil
+}
+
+// SetContext stores value with given ttl
+func (c *memory) SetContext(ctx context.Context, key string, val interface{}, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.SetWithTTL(key, val, ttl)
+	return nil
+}
+
+// DeleteContext deletes key if it exists
+func (c *memory) DeleteContext(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.Delete(key)
+	return nil
+}
+
+// Stats returns statistics of cache, expired items removed by gc are counted as evictions
+func (c *memory) Stats() Stats {
+	c.RLock()
+	size := len(c.items)
+	c.RUnlock()
+	return c.stats.stats(int64(size))
 }
 
 func NewMemoryCache(cfg Config) Cache {
+	stats := &recorder{}
 	c := &memory{
-		storage: &sync.Map{},
+		items:  make(map[string]*item),
+		loader: &loader{cfg: cfg.Load, stats: stats},
+		stats:  stats,
 	}
 	go c.runGc(cfg)
 	return c
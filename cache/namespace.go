@@ -0,0 +1,219 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// NotSupportedError is returned when underlying cache does not support operation
+var NotSupportedError = errors.New("operation not supported by cache")
+
+// prefixDeleter is implemented by built-in backends, it deletes keys by prefix
+type prefixDeleter interface {
+	deletePrefix(prefix string) error
+}
+
+// namespaced prefixes keys of underlying cache with namespace
+type namespaced struct {
+	cache     Cache
+	namespace string
+	prefix    string
+}
+
+// WithNamespace returns view of cache whose keys are prefixed with namespace and NamespaceSeparator,
+// ClearAll of the view deletes only keys of namespace (redis keys are found with SCAN).
+// Tags are not prefixed so InvalidateTags removes related keys of every namespace
+func WithNamespace(c Cache, namespace string) Cache {
+	return &namespaced{
+		cache:     c,
+		namespace: namespace,
+		prefix:    namespace + NamespaceSeparator,
+	}
+}
+
+func (c *namespaced) key(key string) string {
+	return c.prefix + key
+}
+
+func (c *namespaced) keys(keys []string) []string {
+	prefixed := make([]string, len(keys))
+	for i, k := range keys {
+		prefixed[i] = c.key(k)
+	}
+	return prefixed
+}
+
+func (c *namespaced) Get(key string) interface{} {
+	return c.cache.Get(c.key(key))
+}
+
+// GetOrElse passes key without namespace to warmup function
+func (c *namespaced) GetOrElse(key string, wuf func(key string) interface{}, expire ...int64) interface{} {
+	return c.cache.GetOrElse(c.key(key), func(string) interface{} {
+		return wuf(key)
+	}, expire...)
+}
+
+func (c *namespaced) GetMulti(keys []string) []interface{} {
+	return c.cache.GetMulti(c.keys(keys))
+}
+
+func (c *namespaced) Set(key string, val interface{}, expire int64) {
+	c.cache.Set(c.key(key), val, expire)
+}
+
+func (c *namespaced) Delete(key string) {
+	c.cache.Delete(c.key(key))
+}
+
+func (c *namespaced) Incr(key string) error {
+	return c.cache.Incr(c.key(key))
+}
+
+func (c *namespaced) Decr(key string) error {
+	return c.cache.Decr(c.key(key))
+}
+
+func (c *namespaced) IncrBy(key string, delta int64) (int64, error) {
+	return c.cache.IncrBy(c.key(key), delta)
+}
+
+func (c *namespaced) DecrBy(key string, delta int64) (int64, error) {
+	return c.cache.DecrBy(c.key(key), delta)
+}
+
+func (c *namespaced) SetMulti(items map[string]Item) {
+	prefixed := make(map[string]Item, len(items))
+	for k, v := range items {
+		prefixed[c.key(k)] = v
+	}
+	c.cache.SetMulti(prefixed)
+}
+
+func (c *namespaced) DeleteMulti(keys []string) {
+	c.cache.DeleteMulti(c.keys(keys))
+}
+
+// GetOrElseMulti passes keys without namespace to loader
+func (c *namespaced) GetOrElseMulti(keys []string, loader func(keys []string) map[string]interface{}, expire ...int64) []interface{} {
+	return c.cache.GetOrElseMulti(c.keys(keys), func(prefixed []string) map[string]interface{} {
+		unprefixed := make([]string, len(prefixed))
+		for i, k := range prefixed {
+			unprefixed[i] = k[len(c.prefix):]
+		}
+		loaded := make(map[string]interface{}, len(prefixed))
+		for k, v := range loader(unprefixed) {
+			loaded[c.key(k)] = v
+		}
+		return loaded
+	}, expire...)
+}
+
+func (c *namespaced) IsExist(key string) bool {
+	return c.cache.IsExist(c.key(key))
+}
+
+// ClearAll deletes keys of namespace
+func (c *namespaced) ClearAll() {
+	_ = c.deletePrefix("")
+}
+
+func (c *namespaced) deletePrefix(prefix string) error {
+	d, ok := c.cache.(prefixDeleter)
+	if !ok {
+		return NotSupportedError
+	}
+	return d.deletePrefix(c.key(prefix))
+}
+
+// Stats returns statistics of namespace, Size is not tracked by namespace
+func (c *namespaced) Stats() Stats {
+	// nested namespace is counted in its top level namespace
+	s := c.cache.Stats().Namespaces[namespaceOf(c.prefix)]
+	s.Size = -1
+	return s
+}
+
+func (c *namespaced) runGc(config Config) {
+}
+
+func (c *namespaced) GetContext(ctx context.Context, key string) (interface{}, error) {
+	cc, ok := c.cache.(ContextCache)
+	if !ok {
+		cc = contextAdapter{c.cache}
+	}
+	return cc.GetContext(ctx, c.key(key))
+}
+
+func (c *namespaced) GetMultiContext(ctx context.Context, keys []string) ([]interface{}, error) {
+	cc, ok := c.cache.(ContextCache)
+	if !ok {
+		cc = contextAdapter{c.cache}
+	}
+	return cc.GetMultiContext(ctx, c.keys(keys))
+}
+
+func (c *namespaced) SetContext(ctx context.Context, key string, val interface{}, ttl time.Duration) error {
+	cc, ok := c.cache.(ContextCache)
+	if !ok {
+		cc = contextAdapter{c.cache}
+	}
+	return cc.SetContext(ctx, c.key(key), val, ttl)
+}
+
+func (c *namespaced) DeleteContext(ctx context.Context, key string) error {
+	cc, ok := c.cache.(ContextCache)
+	if !ok {
+		cc = contextAdapter{c.cache}
+	}
+	return cc.DeleteContext(ctx, c.key(key))
+}
+
+func (c *namespaced) SetWithTTL(key string, val interface{}, ttl time.Duration) {
+	if e, ok := c.cache.(Expirer); ok {
+		e.SetWithTTL(c.key(key), val, ttl)
+		return
+	}
+	c.cache.Set(c.key(key), val, int64((ttl+time.Second-1)/time.Second))
+}
+
+func (c *namespaced) TTL(key string) (time.Duration, error) {
+	e, ok := c.cache.(Expirer)
+	if !ok {
+		return 0, NotSupportedError
+	}
+	return e.TTL(c.key(key))
+}
+
+func (c *namespaced) Expire(key string, ttl time.Duration) error {
+	e, ok := c.cache.(Expirer)
+	if !ok {
+		return NotSupportedError
+	}
+	return e.Expire(c.key(key), ttl)
+}
+
+func (c *namespaced) Persist(key string) error {
+	e, ok := c.cache.(Expirer)
+	if !ok {
+		return NotSupportedError
+	}
+	return e.Persist(c.key(key))
+}
+
+func (c *namespaced) SetWithTags(key string, val interface{}, ttl time.Duration, tags ...string) {
+	if t, ok := c.cache.(Tagger); ok {
+		t.SetWithTags(c.key(key), val, ttl, tags...)
+		return
+	}
+	c.SetWithTTL(key, val, ttl)
+}
+
+func (c *namespaced) InvalidateTags(tags ...string) error {
+	t, ok := c.cache.(Tagger)
+	if !ok {
+		return NotSupportedError
+	}
+	return t.InvalidateTags(tags...)
+}
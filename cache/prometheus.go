@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	hitsDesc = prometheus.NewDesc("denny_cache_hits_total",
+		"Number of cache hits", []string{"cache", "namespace"}, nil)
+	missesDesc = prometheus.NewDesc("denny_cache_misses_total",
+		"Number of cache misses", []string{"cache", "namespace"}, nil)
+	loadsDesc = prometheus.NewDesc("denny_cache_loads_total",
+		"Number of warm up calls", []string{"cache", "namespace"}, nil)
+	loadErrorsDesc = prometheus.NewDesc("denny_cache_load_errors_total",
+		"Number of warm up calls which returned no value", []string{"cache", "namespace"}, nil)
+	loadSecondsDesc = prometheus.NewDesc("denny_cache_load_seconds_total",
+		"Total time spent in warm up calls", []string{"cache", "namespace"}, nil)
+	evictionsDesc = prometheus.NewDesc("denny_cache_evictions_total",
+		"Number of evicted entries", []string{"cache", "namespace"}, nil)
+	rejectionsDesc = prometheus.NewDesc("denny_cache_rejections_total",
+		"Number of values which were not stored", []string{"cache", "namespace"}, nil)
+	sizeDesc = prometheus.NewDesc("denny_cache_size",
+		"Number of cached entries", []string{"cache"}, nil)
+)
+
+// Collector exports stats of caches as prometheus metrics, counters are labelled by cache name and namespace
+type Collector struct {
+	caches map[string]Cache
+}
+
+// NewCollector creates collector of caches keyed by name, register it with prometheus.MustRegister
+func NewCollector(caches map[string]Cache) *Collector {
+	return &Collector{caches: caches}
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{hitsDesc, missesDesc, loadsDesc, loadErrorsDesc, loadSecondsDesc, evictionsDesc, rejectionsDesc, sizeDesc} {
+		ch <- desc
+	}
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for name, cache := range c.caches {
+		stats := cache.Stats()
+		if stats.Size >= 0 {
+			ch <- prometheus.MustNewConstMetric(sizeDesc, prometheus.GaugeValue, float64(stats.Size), name)
+		}
+		namespaces := stats.Namespaces
+		if len(namespaces) == 0 {
+			namespaces = map[string]Stats{"": stats}
+		}
+		for ns, s := range namespaces {
+			ch <- prometheus.MustNewConstMetric(hitsDesc, prometheus.CounterValue, float64(s.Hits), name, ns)
+			ch <- prometheus.MustNewConstMetric(missesDesc, prometheus.CounterValue, float64(s.Misses), name, ns)
+			ch <- prometheus.MustNewConstMetric(loadsDesc, prometheus.CounterValue, float64(s.Loads), name, ns)
+			ch <- prometheus.MustNewConstMetric(loadErrorsDesc, prometheus.CounterValue, float64(s.LoadErrors), name, ns)
+			ch <- prometheus.MustNewConstMetric(loadSecondsDesc, prometheus.CounterValue, s.LoadTime.Seconds(), name, ns)
+			ch <- prometheus.MustNewConstMetric(evictionsDesc, prometheus.CounterValue, float64(s.Evictions), name, ns)
+			ch <- prometheus.MustNewConstMetric(rejectionsDesc, prometheus.CounterValue, float64(s.Rejections), name, ns)
+		}
+	}
+}
@@ -1,16 +1,40 @@
 package cache
 
 import (
-	redisCli "github.com/go-redis/redis"
+	"context"
+	"encoding"
+	"strconv"
+	"strings"
 	"time"
+
+	redisCli "github.com/go-redis/redis"
+	"github.com/google/uuid"
+	"github.com/whatvn/denny/log"
+	"github.com/whatvn/denny/redisconn"
 )
 
 type redis struct {
-	cli *redisCli.Client
+	cli     redisCli.UniversalClient
+	loader  *loader
+	stats   *recorder
+	flushDB bool
 }
 
+// releaseLockScript deletes lock only when it's still held by caller
+var releaseLockScript = redisCli.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`)
+
 // Get return value if key exist or nil if it does not
 func (c *redis) Get(key string) interface{} {
+	v := c.get(key)
+	c.stats.hit(key, v != nil)
+	return v
+}
+
+func (c *redis) get(key string) interface{} {
 	cmd := c.cli.Get(key)
 	s, err := cmd.Result()
 	if err != nil {
@@ -19,21 +43,152 @@ func (c *redis) Get(key string) interface{} {
 	return s
 }
 
-// GetOrElse return value if it exists, else warmup using warmup function
+// GetOrElse return value if it exists, else warmup using warmup function,
+// concurrent misses of the same key share one warmup call, with LoadConfig.LockTTL
+// one warmup call runs across all processes sharing redis
 func (c *redis) GetOrElse(key string, wuf func(key string) interface{}, expire ...int64) interface{} {
-	v := c.Get(key)
-	if v != nil {
-		return v
+	var expired int64 = 0
+	if len(expire) > 0 {
+		expired = expire[0]
 	}
-	if v := wuf(key); v != nil {
-		var expired int64 = 0
-		if len(expire) > 0 {
-			expired = expire[0]
+	v, _, _ := c.getOrElse(key, wuf, time.Duration(expired)*time.Second, nil)
+	return v
+}
+
+// getOrElse works as GetOrElse, stored is called with every value loaded by wuf once it's written to redis,
+// including values refreshed in background. hit is false when value is loaded by this call,
+// refreshing is true when value is being refreshed in background and is about to be replaced
+func (c *redis) getOrElse(key string, wuf func(key string) interface{}, ttl time.Duration, stored func(v interface{})) (v interface{}, hit, refreshing bool) {
+	cfg := c.loader.cfg
+	if cfg.StaleWhileRevalidate > 0 || cfg.EarlyRefreshBeta > 0 {
+		pipe := c.cli.Pipeline()
+		get, pttl := pipe.Get(key), pipe.PTTL(key)
+		_, _ = pipe.Exec()
+		if s, err := get.Result(); err == nil {
+			// key without expiry has negative pttl
+			c.stats.hit(key, true)
+			remaining, err := pttl.Result()
+			if err != nil || remaining < 0 {
+				return s, true, false
+			}
+			// stale window is part of key ttl
+			remaining -= cfg.StaleWhileRevalidate
+			if remaining <= 0 || c.loader.refreshEarly(key, remaining) {
+				c.loader.refresh(key, func() interface{} {
+					return c.lockedWarmUp(key, wuf, ttl, false, stored)
+				})
+				return s, true, true
+			}
+			return s, true, false
 		}
-		c.Set(key, v, expired)
+	} else if v := c.get(key); v != nil {
+		c.stats.hit(key, true)
+		return v, true, false
+	}
+	c.stats.hit(key, false)
+	loaded := false
+	v = c.loader.load(key, func() interface{} {
+		// value may be loaded by previous call while this one waited
+		if v := c.get(key); v != nil {
+			return v
+		}
+		loaded = true
+		return c.lockedWarmUp(key, wuf, ttl, true, stored)
+	})
+	return v, !loaded, false
+}
+
+// warmUp loads value and stores it, stale window is added to ttl so stale value can be served
+func (c *redis) warmUp(key string, wuf func(key string) interface{}, ttl time.Duration, stored func(v interface{})) interface{} {
+	v := wuf(key)
+	if v == nil {
+		return nil
+	}
+	if ttl > 0 {
+		ttl += c.loader.cfg.StaleWhileRevalidate
+	}
+	if err := c.cli.Set(key, v, ttl).Err(); err == nil && stored != nil {
+		stored(v)
+	}
+	return v
+}
+
+// lockedWarmUp calls warmUp holding distributed lock of key when LoadConfig.LockTTL is set,
+// when lock is held by other process, it waits for value loaded by lock holder if wait is true,
+// otherwise it returns nil
+func (c *redis) lockedWarmUp(key string, wuf func(key string) interface{}, ttl time.Duration, wait bool, stored func(v interface{})) interface{} {
+	lockTTL := c.loader.cfg.LockTTL
+	if lockTTL <= 0 {
+		return c.warmUp(key, wuf, ttl, stored)
+	}
+	lockKey, token := key+":loading", uuid.New().String()
+	acquired, err := c.cli.SetNX(lockKey, token, lockTTL).Result()
+	if err != nil || acquired {
+		if acquired {
+			defer releaseLockScript.Run(c.cli, []string{lockKey}, token)
+		}
+		return c.warmUp(key, wuf, ttl, stored)
+	}
+	if !wait {
+		return nil
+	}
+	deadline := time.Now().Add(c.loader.lockWait())
+	interval := c.loader.lockWait() / 20
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+		if v := c.get(key); v != nil {
+			return v
+		}
+	}
+	return c.warmUp(key, wuf, ttl, stored)
+}
+
+// redisValue returns value as it's read back from redis after go-redis writes it,
+// so local copies of tiered cache have the same type as values read from redis
+func redisValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
 		return v
+	case []byte:
+		return string(v)
+	case int:
+		return strconv.FormatInt(int64(v), 10)
+	case int8:
+		return strconv.FormatInt(int64(v), 10)
+	case int16:
+		return strconv.FormatInt(int64(v), 10)
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 64)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case encoding.BinaryMarshaler:
+		if b, err := v.MarshalBinary(); err == nil {
+			return string(b)
+		}
 	}
-	return nil
+	return v
 }
 
 // Set store key in sync map
@@ -43,19 +198,100 @@ func (c *redis) Set(key string, val interface{}, expire int64) {
 
 // Get multi will load all values with given keys
 // caller has to check request return value against nil befors using
-// as this call will not check key existence
+// as this call will not check key existence, nil is returned when redis call fails,
+// use GetMultiContext to get the error
 func (c *redis) GetMulti(keys []string) []interface{} {
-	cmd := c.cli.MGet(keys...)
-	result, err := cmd.Result()
+	values, _ := c.GetMultiContext(context.Background(), keys)
+	return values
+}
+
+// GetMultiContext returns values of keys as strings, values of missing keys are nil,
+// *BackendError is returned when redis call fails
+func (c *redis) GetMultiContext(ctx context.Context, keys []string) ([]interface{}, error) {
+	values, err := c.getMulti(c.withContext(ctx), keys)
 	if err != nil {
-		return nil
+		return nil, &BackendError{Op: "mget", Key: strings.Join(keys, ","), Err: err}
+	}
+	for i, v := range values {
+		c.stats.hit(keys[i], v != nil)
+	}
+	return values, nil
+}
+
+// getMulti reads keys with MGET, on redis cluster keys may belong to different hash slots
+// which MGET rejects, they are read with pipelined GETs instead
+func (c *redis) getMulti(cli redisCli.Cmdable, keys []string) ([]interface{}, error) {
+	if _, ok := c.cli.(*redisCli.ClusterClient); !ok {
+		return cli.MGet(keys...).Result()
+	}
+	pipe := cli.Pipeline()
+	cmds := make([]*redisCli.StringCmd, len(keys))
+	for i, k := range keys {
+		cmds[i] = pipe.Get(k)
+	}
+	// missing keys make Exec return redis.Nil, errors are checked per command
+	_, _ = pipe.Exec()
+	values := make([]interface{}, len(keys))
+	for i, cmd := range cmds {
+		s, err := cmd.Result()
+		switch {
+		case err == redisCli.Nil:
+		case err != nil:
+			return nil, err
+		default:
+			values[i] = s
+		}
 	}
-	return result
+	return values, nil
 }
 
 // Delete delete key in map if it exists
 func (c *redis) Delete(key string) {
 	c.cli.Del(key)
+	c.loader.forget(key)
+}
+
+// SetMulti stores values in one pipeline
+func (c *redis) SetMulti(items map[string]Item) {
+	pipe := c.cli.Pipeline()
+	for k, v := range items {
+		pipe.Set(k, v.Value, v.TTL)
+	}
+	_, _ = pipe.Exec()
+}
+
+// DeleteMulti deletes keys in one pipeline, keys are deleted one by one as they may belong to different cluster slots
+func (c *redis) DeleteMulti(keys []string) {
+	pipe := c.cli.Pipeline()
+	for _, k := range keys {
+		pipe.Del(k)
+	}
+	_, _ = pipe.Exec()
+	c.loader.forget(keys...)
+}
+
+// IncrBy increases value of key by delta, missing key is created with value delta
+func (c *redis) IncrBy(key string, delta int64) (int64, error) {
+	v, err := c.cli.IncrBy(key, delta).Result()
+	if err != nil {
+		return 0, &BackendError{Op: "incr", Key: key, Err: err}
+	}
+	return v, nil
+}
+
+// DecrBy decreases value of key by delta, missing key is created with value -delta
+func (c *redis) DecrBy(key string, delta int64) (int64, error) {
+	v, err := c.cli.DecrBy(key, delta).Result()
+	if err != nil {
+		return 0, &BackendError{Op: "decr", Key: key, Err: err}
+	}
+	return v, nil
+}
+
+// GetOrElseMulti returns values of keys with MGET, missing ones are loaded by one loader call
+// and stored in one pipeline
+func (c *redis) GetOrElseMulti(keys []string, loader func(keys []string) map[string]interface{}, expire ...int64) []interface{} {
+	return getOrElseMulti(c, c.stats, keys, loader, expire...)
 }
 
 // Incr incr key in map if it exists
@@ -76,6 +312,52 @@ func (c *redis) Decr(key string) error {
 	return nil
 }
 
+// SetWithTTL store value with millisecond precision, 0 ttl means value never expires
+func (c *redis) SetWithTTL(key string, val interface{}, ttl time.Duration) {
+	c.cli.Set(key, val, ttl)
+}
+
+// TTL returns remaining time to live of key, NoExpiration when key never expires
+func (c *redis) TTL(key string) (time.Duration, error) {
+	ttl, err := c.cli.PTTL(key).Result()
+	if err != nil {
+		return 0, &BackendError{Op: "ttl", Key: key, Err: err}
+	}
+	// redis replies -2 when key does not exist and -1 when key has no expiry
+	switch ttl {
+	case -2 * time.Millisecond:
+		return 0, ValueNotExistError
+	case -1 * time.Millisecond:
+		return NoExpiration, nil
+	}
+	return ttl, nil
+}
+
+// Expire sets time to live of key, non positive ttl deletes key
+func (c *redis) Expire(key string, ttl time.Duration) error {
+	ok, err := c.cli.PExpire(key, ttl).Result()
+	if err != nil {
+		return &BackendError{Op: "expire", Key: key, Err: err}
+	}
+	if !ok {
+		return ValueNotExistError
+	}
+	return nil
+}
+
+// Persist removes expiry of key
+func (c *redis) Persist(key string) error {
+	ok, err := c.cli.Persist(key).Result()
+	if err != nil {
+		return &BackendError{Op: "persist", Key: key, Err: err}
+	}
+	// persist replies 0 for both missing key and key without expiry
+	if !ok && !c.IsExist(key) {
+		return ValueNotExistError
+	}
+	return nil
+}
+
 func (c *redis) IsExist(key string) bool {
 	cmd := c.cli.Exists(key)
 	val, err := cmd.Result()
@@ -85,8 +367,111 @@ func (c *redis) IsExist(key string) bool {
 	return val > 0
 }
 
+// ClearAll deletes every key of redis database cache is connected to (of every master on cluster)
+// when RedisConfig.FlushDB is set, otherwise it's refused as database may be shared,
+// use namespaced cache (see WithNamespace) to clear only keys of a namespace
 func (c *redis) ClearAll() {
-	c.cli.FlushAll()
+	if !c.flushDB {
+		log.New().WithField("cache", "redis").
+			Warn("cache: ClearAll of redis cache is refused, set RedisConfig.FlushDB or use WithNamespace")
+		return
+	}
+	if cluster, ok := c.cli.(*redisCli.ClusterClient); ok {
+		_ = cluster.ForEachMaster(func(client *redisCli.Client) error {
+			return client.FlushDB().Err()
+		})
+		return
+	}
+	c.cli.FlushDB()
+}
+
+// SetWithTags stores value and attaches tags to key
+func (c *redis) SetWithTags(key string, val interface{}, ttl time.Duration, tags ...string) {
+	pipe := c.cli.Pipeline()
+	pipe.Set(key, val, ttl)
+	for _, tag := range tags {
+		addTagScript.Eval(pipe, []string{tagKey(tag)}, key, int64(ttl/time.Millisecond))
+	}
+	_, _ = pipe.Exec()
+}
+
+// InvalidateTags deletes every key attached to given tags
+func (c *redis) InvalidateTags(tags ...string) error {
+	_, err := c.invalidateTags(tags)
+	return err
+}
+
+// invalidateTags deletes keys attached to tags and returns them
+func (c *redis) invalidateTags(tags []string) ([]string, error) {
+	var keys []string
+	for _, tag := range tags {
+		members, err := c.cli.SMembers(tagKey(tag)).Result()
+		if err != nil {
+			return nil, &BackendError{Op: "invalidate tag", Key: tag, Err: err}
+		}
+		keys = append(keys, members...)
+	}
+	// keys are deleted one by one as they may belong to different cluster slots
+	pipe := c.cli.Pipeline()
+	for _, key := range keys {
+		pipe.Del(key)
+	}
+	for _, tag := range tags {
+		pipe.Del(tagKey(tag))
+	}
+	if _, err := pipe.Exec(); err != nil {
+		return nil, &BackendError{Op: "invalidate tags", Err: err}
+	}
+	return keys, nil
+}
+
+// deletePrefix deletes every key starting with prefix using SCAN, on cluster every master is scanned
+func (c *redis) deletePrefix(prefix string) error {
+	pattern := escapePattern(prefix) + "*"
+	if cluster, ok := c.cli.(*redisCli.ClusterClient); ok {
+		return cluster.ForEachMaster(func(client *redisCli.Client) error {
+			return scanDelete(client, pattern)
+		})
+	}
+	return scanDelete(c.cli, pattern)
+}
+
+func scanDelete(cli redisCli.Cmdable, pattern string) error {
+	var cursor uint64
+	for {
+		keys, next, err := cli.Scan(cursor, pattern, 500).Result()
+		if err != nil {
+			return &BackendError{Op: "scan", Key: pattern, Err: err}
+		}
+		if len(keys) > 0 {
+			pipe := cli.Pipeline()
+			for _, key := range keys {
+				pipe.Del(key)
+			}
+			if _, err := pipe.Exec(); err != nil {
+				return &BackendError{Op: "delete", Key: pattern, Err: err}
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// escapePattern escapes glob characters of redis SCAN MATCH pattern
+func escapePattern(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`).Replace(s)
+}
+
+// Stats returns statistics of cache, Size is number of keys of redis database
+// and evictions are not tracked as redis evicts keys itself
+func (c *redis) Stats() Stats {
+	size, err := c.cli.DBSize().Result()
+	if err != nil {
+		size = -1
+	}
+	return c.stats.stats(size)
 }
 
 func (c *redis) runGc(config Config) {
@@ -96,12 +481,85 @@ func (c *redis) expires() []string {
 	return nil
 }
 
+// withContext returns client bound to ctx, client which does not support context is returned as is
+func (c *redis) withContext(ctx context.Context) redisCli.Cmdable {
+	switch cli := c.cli.(type) {
+	case *redisCli.Client:
+		return cli.WithContext(ctx)
+	case *redisCli.ClusterClient:
+		return cli.WithContext(ctx)
+	case *redisCli.Ring:
+		return cli.WithContext(ctx)
+	}
+	return c.cli
+}
+
+// GetContext returns value as string, ValueNotExistError when key does not exist
+// or *BackendError when redis call fails
+func (c *redis) GetContext(ctx context.Context, key string) (interface{}, error) {
+	s, err := c.withContext(ctx).Get(key).Result()
+	if err == redisCli.Nil {
+		c.stats.hit(key, false)
+		return nil, ValueNotExistError
+	}
+	if err != nil {
+		return nil, &BackendError{Op: "get", Key: key, Err: err}
+	}
+	c.stats.hit(key, true)
+	return s, nil
+}
+
+// SetContext stores value with given ttl
+func (c *redis) SetContext(ctx context.Context, key string, val interface{}, ttl time.Duration) error {
+	if err := c.withContext(ctx).Set(key, val, ttl).Err(); err != nil {
+		return &BackendError{Op: "set", Key: key, Err: err}
+	}
+	return nil
+}
+
+// DeleteContext deletes key if it exists
+func (c *redis) DeleteContext(ctx context.Context, key string) error {
+	if err := c.withContext(ctx).Del(key).Err(); err != nil {
+		return &BackendError{Op: "delete", Key: key, Err: err}
+	}
+	c.loader.forget(key)
+	return nil
+}
+
+// RedisOptions is redis connection options of cache, see redisconn.Options
+type RedisOptions = redisconn.Options
+
+// RedisConfig configures redis cache
+type RedisConfig struct {
+	Options RedisOptions
+	// Load controls GetOrElse loading behaviour
+	Load LoadConfig
+	// FlushDB lets ClearAll flush whole redis database, ClearAll does nothing without it
+	// as database may be shared with other applications
+	FlushDB bool
+}
+
 func NewRedis(address, password string) Cache {
+	return NewRedisWithOptions(RedisOptions{
+		Addr:     address,
+		Password: password,
+	})
+}
+
+// NewRedisWithOptions creates redis cache which can connect to
+// single redis server, redis sentinel or redis cluster
+func NewRedisWithOptions(opts RedisOptions) Cache {
+	return NewRedisWithConfig(RedisConfig{Options: opts})
+}
+
+// NewRedisWithConfig creates redis cache with loading behaviour
+func NewRedisWithConfig(cfg RedisConfig) Cache {
+	stats := &recorder{}
 	c := &redis{
-		cli: redisCli.NewClient(&redisCli.Options{
-			Addr:     address,
-			Password: password,
-		}),
+		cli:     cfg.Options.NewClient(),
+		loader:  &loader{cfg: cfg.Load, stats: stats},
+		stats:   stats,
+		flushDB: cfg.FlushDB,
 	}
 	return c
 }
@@ -1,11 +0,0 @@
-package cache
-
-//
-//func NewRedisCluster()  {
-//	slotFunc := func() {
-//		slot := []redisCli.ClusterNode{
-//
-//		}
-//	}
-//
-//}
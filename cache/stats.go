@@ -0,0 +1,187 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/whatvn/denny/log"
+)
+
+// NamespaceSeparator separates namespace from the rest of key, stats of key user:42 are counted in namespace user
+const NamespaceSeparator = ":"
+
+// maxStatsNamespaces bounds number of namespaces stats are broken down by,
+// keys of further namespaces are counted in OtherNamespace
+const maxStatsNamespaces = 64
+
+// OtherNamespace collects stats of keys beyond namespaces limit
+const OtherNamespace = "_other"
+
+// Stats reports cache effectiveness, counters are cumulative since cache is created
+type Stats struct {
+	Hits   int64
+	Misses int64
+	// Loads is number of warm up calls made by GetOrElse, LoadErrors counts those returning nil
+	Loads      int64
+	LoadErrors int64
+	// LoadTime is total time spent in warm up calls
+	LoadTime  time.Duration
+	Evictions int64
+	// Rejections is number of values which were not stored, eg: entry larger than bounded cache limit
+	Rejections int64
+	// Size is current number of entries, it's -1 when backend can not tell
+	Size int64
+	// Namespaces breaks counters down by namespace (part of key before NamespaceSeparator),
+	// keys without namespace are counted in "", Size is not broken down
+	Namespaces map[string]Stats
+}
+
+// HitRatio returns hits / (hits + misses)
+func (s Stats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// AvgLoadTime returns average duration of warm up call
+func (s Stats) AvgLoadTime() time.Duration {
+	if s.Loads == 0 {
+		return 0
+	}
+	return s.LoadTime / time.Duration(s.Loads)
+}
+
+type counters struct {
+	hits, misses, loads, loadErrors, loadNanos, evictions, rejections int64
+}
+
+func (c *counters) stats() Stats {
+	return Stats{
+		Hits:       atomic.LoadInt64(&c.hits),
+		Misses:     atomic.LoadInt64(&c.misses),
+		Loads:      atomic.LoadInt64(&c.loads),
+		LoadErrors: atomic.LoadInt64(&c.loadErrors),
+		LoadTime:   time.Duration(atomic.LoadInt64(&c.loadNanos)),
+		Evictions:  atomic.LoadInt64(&c.evictions),
+		Rejections: atomic.LoadInt64(&c.rejections),
+	}
+}
+
+// recorder counts cache events in total and by namespace
+type recorder struct {
+	total      counters
+	mu         sync.RWMutex
+	namespaces map[string]*counters
+}
+
+func namespaceOf(key string) string {
+	if i := strings.Index(key, NamespaceSeparator); i >= 0 {
+		return key[:i]
+	}
+	return ""
+}
+
+func (r *recorder) namespace(key string) *counters {
+	ns := namespaceOf(key)
+	r.mu.RLock()
+	c, ok := r.namespaces[ns]
+	r.mu.RUnlock()
+	if ok {
+		return c
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.namespaces == nil {
+		r.namespaces = make(map[string]*counters)
+	}
+	if c, ok = r.namespaces[ns]; ok {
+		return c
+	}
+	if len(r.namespaces) >= maxStatsNamespaces {
+		ns = OtherNamespace
+		if c, ok = r.namespaces[ns]; ok {
+			return c
+		}
+	}
+	c = &counters{}
+	r.namespaces[ns] = c
+	return c
+}
+
+func (r *recorder) add(key string, field func(c *counters) *int64, delta int64) {
+	atomic.AddInt64(field(&r.total), delta)
+	atomic.AddInt64(field(r.namespace(key)), delta)
+}
+
+// hit records hit when found is true, otherwise miss
+func (r *recorder) hit(key string, found bool) {
+	if found {
+		r.add(key, func(c *counters) *int64 { return &c.hits }, 1)
+		return
+	}
+	r.add(key, func(c *counters) *int64 { return &c.misses }, 1)
+}
+
+func (r *recorder) load(key string, elapsed time.Duration, failed bool) {
+	r.add(key, func(c *counters) *int64 { return &c.loads }, 1)
+	r.add(key, func(c *counters) *int64 { return &c.loadNanos }, int64(elapsed))
+	if failed {
+		r.add(key, func(c *counters) *int64 { return &c.loadErrors }, 1)
+	}
+}
+
+func (r *recorder) evict(key string) {
+	r.add(key, func(c *counters) *int64 { return &c.evictions }, 1)
+}
+
+func (r *recorder) reject(key string) {
+	r.add(key, func(c *counters) *int64 { return &c.rejections }, 1)
+}
+
+// stats returns snapshot of counters with given size
+func (r *recorder) stats(size int64) Stats {
+	s := r.total.stats()
+	s.Size = size
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s.Namespaces = make(map[string]Stats, len(r.namespaces))
+	for ns, c := range r.namespaces {
+		s.Namespaces[ns] = c.stats()
+	}
+	return s
+}
+
+// LogStats writes stats of cache with given name to logger
+func LogStats(logger *log.Log, name string, c Cache) {
+	s := c.Stats()
+	logger.WithFields(map[string]interface{}{
+		"cache":         name,
+		"hits":          s.Hits,
+		"misses":        s.Misses,
+		"hit_ratio":     s.HitRatio(),
+		"loads":         s.Loads,
+		"load_errors":   s.LoadErrors,
+		"avg_load_time": s.AvgLoadTime().String(),
+		"evictions":     s.Evictions,
+		"rejections":    s.Rejections,
+		"size":          s.Size,
+	}).Infof("cache stats")
+}
+
+// ReportStats logs stats of cache with given name every interval until ctx is done
+func ReportStats(ctx context.Context, interval time.Duration, name string, c Cache) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			LogStats(log.New(), name, c)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"sync"
+	"time"
+
+	redisCli "github.com/go-redis/redis"
+)
+
+// Tagger is implemented by built-in backends and namespaced caches, entries stored with tags
+// are removed together by InvalidateTags, eg: every entry related to user 42 is tagged with user:42
+type Tagger interface {
+	// SetWithTags stores value and attaches tags to key, zero ttl means value never expires
+	SetWithTags(key string, val interface{}, ttl time.Duration, tags ...string)
+	// InvalidateTags deletes every key attached to given tags
+	InvalidateTags(tags ...string) error
+}
+
+// tagIndex maps tag to keys attached to it, used by memory backends
+type tagIndex struct {
+	sync.Mutex
+	keys map[string]map[string]struct{}
+}
+
+func (t *tagIndex) add(key string, tags []string) {
+	t.Lock()
+	defer t.Unlock()
+	if t.keys == nil {
+		t.keys = make(map[string]map[string]struct{})
+	}
+	for _, tag := range tags {
+		keys, ok := t.keys[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			t.keys[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+}
+
+// take removes tags and returns keys attached to them
+func (t *tagIndex) take(tags []string) []string {
+	t.Lock()
+	defer t.Unlock()
+	var keys []string
+	for _, tag := range tags {
+		for key := range t.keys[tag] {
+			keys = append(keys, key)
+		}
+		delete(t.keys, tag)
+	}
+	return keys
+}
+
+// clear forgets every tag
+func (t *tagIndex) clear() {
+	t.Lock()
+	defer t.Unlock()
+	t.keys = nil
+}
+
+// prune forgets keys which no longer exist
+func (t *tagIndex) prune(exists func(key string) bool) {
+	t.Lock()
+	defer t.Unlock()
+	for tag, keys := range t.keys {
+		for key := range keys {
+			if !exists(key) {
+				delete(keys, key)
+			}
+		}
+		if len(keys) == 0 {
+			delete(t.keys, tag)
+		}
+	}
+}
+
+// tagKey is redis set holding keys attached to tag
+func tagKey(tag string) string {
+	return "denny:tag:" + tag
+}
+
+// addTagScript adds key to tag set, tag set lives as long as its longest living key
+var addTagScript = redisCli.NewScript(`
+local existed = redis.call("exists", KEYS[1])
+redis.call("sadd", KEYS[1], ARGV[1])
+local ttl = tonumber(ARGV[2])
+if ttl == 0 then
+	redis.call("persist", KEYS[1])
+	return 1
+end
+local current = redis.call("pttl", KEYS[1])
+if existed == 0 or (current >= 0 and current < ttl) then
+	redis.call("pexpire", KEYS[1], ttl)
+end
+return 1`)
@@ -0,0 +1,433 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	redisCli "github.com/go-redis/redis"
+	"github.com/google/uuid"
+	"github.com/whatvn/denny/log"
+)
+
+const defaultInvalidationChannel = "denny:cache:invalidate"
+
+// RemoteNotRedisError is returned by NewTieredCache when remote cache is not created by NewRedis or NewRedisWithOptions
+var RemoteNotRedisError = errors.New("cache: remote cache of tiered cache must be redis cache")
+
+// TieredConfig configures two-level cache
+type TieredConfig struct {
+	// Local is per process cache, default is memory cache
+	Local Cache
+	// Remote is shared cache, it must be created by NewRedis or NewRedisWithOptions
+	Remote Cache
+	// LocalTTL limits how long value is kept in local cache, it should be shorter than remote expiry
+	// as it bounds staleness when invalidation message is lost, default is 1 minute
+	LocalTTL time.Duration
+	// Channel is redis pub/sub channel invalidation messages are broadcast to
+	Channel string
+}
+
+// invalidation is broadcast to every process when keys change,
+// whole cache is cleared when neither key nor prefix is given
+type invalidation struct {
+	Origin string   `json:"origin"`
+	Keys   []string `json:"keys,omitempty"`
+	Prefix string   `json:"prefix,omitempty"`
+}
+
+type tiered struct {
+	id       string
+	stats    *recorder
+	local    Cache
+	remote   *redis
+	localTTL time.Duration
+	channel  string
+	pubsub   *redisCli.PubSub
+}
+
+// NewTieredCache creates cache which reads local cache first then remote redis cache, writes go to both.
+// Changes are broadcast through redis pub/sub so every process evicts its local copy. When redis can not be
+// subscribed to, eg: it's not reachable yet, subscription is retried in background and local copies
+// are kept at most LocalTTL meanwhile. RemoteNotRedisError is returned when remote cache is not redis cache
+func NewTieredCache(cfg TieredConfig) (Cache, error) {
+	remote, ok := cfg.Remote.(*redis)
+	if !ok {
+		return nil, RemoteNotRedisError
+	}
+	c := &tiered{
+		id:       uuid.New().String(),
+		stats:    &recorder{},
+		local:    cfg.Local,
+		remote:   remote,
+		localTTL: cfg.LocalTTL,
+		channel:  cfg.Channel,
+	}
+	if c.local == nil {
+		c.local = NewMemoryCache(Config{GcDuration: 60})
+	}
+	if c.localTTL <= 0 {
+		c.localTTL = time.Minute
+	}
+	if len(c.channel) == 0 {
+		c.channel = defaultInvalidationChannel
+	}
+	c.pubsub = remote.cli.Subscribe(c.channel)
+	// wait for subscription confirmation so no invalidation is missed after constructor returns,
+	// on failure listen keeps reconnecting and subscribes again
+	if _, err := c.pubsub.Receive(); err != nil {
+		log.New().WithField("channel", c.channel).WithError(err).
+			Warn("cache: subscribe to invalidation channel failed, retrying in background")
+	}
+	go c.listen()
+	return c, nil
+}
+
+// listen evicts local copies of keys changed by other processes
+func (c *tiered) listen() {
+	for msg := range c.pubsub.Channel() {
+		var inv invalidation
+		if err := json.Unmarshal([]byte(msg.Payload), &inv); err != nil || inv.Origin == c.id {
+			continue
+		}
+		switch {
+		case len(inv.Prefix) > 0:
+			c.deleteLocalPrefix(inv.Prefix)
+		case len(inv.Keys) > 0:
+			for _, key := range inv.Keys {
+				c.local.Delete(key)
+			}
+		default:
+			c.local.ClearAll()
+		}
+	}
+}
+
+func (c *tiered) publish(inv invalidation) {
+	inv.Origin = c.id
+	data, _ := json.Marshal(inv)
+	c.remote.cli.Publish(c.channel, data)
+}
+
+// broadcast evicts local copies of key in other processes, empty key clears their local caches
+func (c *tiered) broadcast(key string) {
+	var inv invalidation
+	if len(key) > 0 {
+		inv.Keys = []string{key}
+	}
+	c.publish(inv)
+}
+
+// deleteLocalPrefix deletes keys with prefix from local cache, it's cleared when it can not delete by prefix
+func (c *tiered) deleteLocalPrefix(prefix string) {
+	if d, ok := c.local.(prefixDeleter); ok && d.deletePrefix(prefix) == nil {
+		return
+	}
+	c.local.ClearAll()
+}
+
+// SetWithTags writes value to both caches, tags are kept in redis
+func (c *tiered) SetWithTags(key string, val interface{}, ttl time.Duration, tags ...string) {
+	c.remote.SetWithTags(key, val, ttl, tags...)
+	c.setLocal(key, val, ttl)
+	c.broadcast(key)
+}
+
+// InvalidateTags deletes keys attached to tags from both caches and evicts local copies of other processes
+func (c *tiered) InvalidateTags(tags ...string) error {
+	keys, err := c.remote.invalidateTags(tags)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		c.local.Delete(key)
+	}
+	if len(keys) > 0 {
+		c.publish(invalidation{Keys: keys})
+	}
+	return nil
+}
+
+// deletePrefix deletes keys with prefix from both caches and from local caches of other processes
+func (c *tiered) deletePrefix(prefix string) error {
+	if err := c.remote.deletePrefix(prefix); err != nil {
+		return err
+	}
+	c.deleteLocalPrefix(prefix)
+	c.publish(invalidation{Prefix: prefix})
+	return nil
+}
+
+// setLocal stores value in local cache, its ttl is capped by LocalTTL,
+// value is stored as it's read from redis so both caches return the same type
+func (c *tiered) setLocal(key string, val interface{}, ttl time.Duration) {
+	val = redisValue(val)
+	if ttl <= 0 || ttl > c.localTTL {
+		ttl = c.localTTL
+	}
+	if e, ok := c.local.(Expirer); ok {
+		e.SetWithTTL(key, val, ttl)
+		return
+	}
+	c.local.Set(key, val, int64((ttl+time.Second-1)/time.Second))
+}
+
+// Get return value from local cache, else from remote cache, or nil if it does not exist
+func (c *tiered) Get(key string) interface{} {
+	if v := c.local.Get(key); v != nil {
+		c.stats.hit(key, true)
+		return v
+	}
+	v := c.remote.Get(key)
+	if v != nil {
+		c.setLocal(key, v, 0)
+	}
+	c.stats.hit(key, v != nil)
+	return v
+}
+
+// GetOrElse return value if it exists in local or remote cache, else warmup using warmup function,
+// value loaded by warmup function, in foreground or in background refresh, is written to both caches
+// and local copies of other processes are evicted
+func (c *tiered) GetOrElse(key string, wuf func(key string) interface{}, expire ...int64) interface{} {
+	if v := c.local.Get(key); v != nil {
+		c.stats.hit(key, true)
+		return v
+	}
+	var expired int64 = 0
+	if len(expire) > 0 {
+		expired = expire[0]
+	}
+	ttl := time.Duration(expired) * time.Second
+	v, hit, refreshing := c.remote.getOrElse(key, func(key string) interface{} {
+		start := time.Now()
+		v := wuf(key)
+		c.stats.load(key, time.Since(start), v == nil)
+		return v
+	}, ttl, func(v interface{}) {
+		c.setLocal(key, v, ttl)
+		c.broadcast(key)
+	})
+	c.stats.hit(key, hit)
+	if v == nil {
+		return nil
+	}
+	v = redisValue(v)
+	// value being refreshed is replaced in local cache once it's loaded
+	if hit && !refreshing {
+		c.setLocal(key, v, ttl)
+	}
+	return v
+}
+
+// Set writes value to both caches and evicts local copies of other processes
+func (c *tiered) Set(key string, val interface{}, expire int64) {
+	c.SetWithTTL(key, val, time.Duration(expire)*time.Second)
+}
+
+// SetWithTTL writes value to both caches and evicts local copies of other processes
+func (c *tiered) SetWithTTL(key string, val interface{}, ttl time.Duration) {
+	c.remote.SetWithTTL(key, val, ttl)
+	c.setLocal(key, val, ttl)
+	c.broadcast(key)
+}
+
+// GetMulti returns values of given keys, keys missing in local cache are read from remote cache at once,
+// when remote cache fails only values found in local cache are returned
+func (c *tiered) GetMulti(keys []string) []interface{} {
+	values, _ := c.getMulti(context.Background(), keys)
+	return values
+}
+
+// GetMultiContext returns values of given keys, keys missing in local cache are read from remote cache at once,
+// *BackendError is returned when remote cache fails
+func (c *tiered) GetMultiContext(ctx context.Context, keys []string) ([]interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	values, err := c.getMulti(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func (c *tiered) getMulti(ctx context.Context, keys []string) ([]interface{}, error) {
+	var (
+		values  = make([]interface{}, len(keys))
+		missing []string
+		index   []int
+	)
+	for i, k := range keys {
+		if values[i] = c.local.Get(k); values[i] == nil {
+			missing = append(missing, k)
+			index = append(index, i)
+		}
+	}
+	if len(missing) == 0 {
+		return values, nil
+	}
+	for i, k := range keys {
+		if values[i] != nil {
+			c.stats.hit(k, true)
+		}
+	}
+	remote, err := c.remote.GetMultiContext(ctx, missing)
+	if err != nil {
+		return values, err
+	}
+	for i, v := range remote {
+		c.stats.hit(missing[i], v != nil)
+		if v != nil {
+			values[index[i]] = v
+			c.setLocal(missing[i], v, 0)
+		}
+	}
+	return values, nil
+}
+
+// SetMulti writes values to both caches and evicts local copies of other processes
+func (c *tiered) SetMulti(items map[string]Item) {
+	c.remote.SetMulti(items)
+	keys := make([]string, 0, len(items))
+	for k, v := range items {
+		c.setLocal(k, v.Value, v.TTL)
+		keys = append(keys, k)
+	}
+	c.publish(invalidation{Keys: keys})
+}
+
+// DeleteMulti deletes keys from both caches and evicts local copies of other processes
+func (c *tiered) DeleteMulti(keys []string) {
+	c.remote.DeleteMulti(keys)
+	for _, k := range keys {
+		c.local.Delete(k)
+	}
+	c.publish(invalidation{Keys: keys})
+}
+
+// IncrBy increases value in remote cache and evicts local copies
+func (c *tiered) IncrBy(key string, delta int64) (int64, error) {
+	v, err := c.remote.IncrBy(key, delta)
+	if err != nil {
+		return 0, err
+	}
+	c.local.Delete(key)
+	c.broadcast(key)
+	return v, nil
+}
+
+// DecrBy decreases value in remote cache and evicts local copies
+func (c *tiered) DecrBy(key string, delta int64) (int64, error) {
+	v, err := c.remote.DecrBy(key, delta)
+	if err != nil {
+		return 0, err
+	}
+	c.local.Delete(key)
+	c.broadcast(key)
+	return v, nil
+}
+
+// GetOrElseMulti returns values of keys found in local or remote cache, missing ones are loaded
+// by one loader call and written to both caches
+func (c *tiered) GetOrElseMulti(keys []string, loader func(keys []string) map[string]interface{}, expire ...int64) []interface{} {
+	return getOrElseMulti(c, c.stats, keys, loader, expire...)
+}
+
+// Delete deletes key from both caches and evicts local copies of other processes
+func (c *tiered) Delete(key string) {
+	c.remote.Delete(key)
+	c.local.Delete(key)
+	c.broadcast(key)
+}
+
+// Incr increases value in remote cache and evicts local copies
+func (c *tiered) Incr(key string) error {
+	if err := c.remote.Incr(key); err != nil {
+		return err
+	}
+	c.local.Delete(key)
+	c.broadcast(key)
+	return nil
+}
+
+// Decr decreases value in remote cache and evicts local copies
+func (c *tiered) Decr(key string) error {
+	if err := c.remote.Decr(key); err != nil {
+		return err
+	}
+	c.local.Delete(key)
+	c.broadcast(key)
+	return nil
+}
+
+func (c *tiered) IsExist(key string) bool {
+	return c.local.IsExist(key) || c.remote.IsExist(key)
+}
+
+// ClearAll clears both caches and local caches of other processes,
+// remote cache is only cleared when it's created with RedisConfig.FlushDB
+func (c *tiered) ClearAll() {
+	c.remote.ClearAll()
+	c.local.ClearAll()
+	c.broadcast("")
+}
+
+// Stats returns statistics of tiered cache, value found in either cache is a hit,
+// Size and Evictions are of local cache
+func (c *tiered) Stats() Stats {
+	local := c.local.Stats()
+	s := c.stats.stats(local.Size)
+	s.Evictions = local.Evictions
+	return s
+}
+
+func (c *tiered) runGc(config Config) {
+}
+
+// Close stops listening to invalidation messages
+func (c *tiered) Close() error {
+	return c.pubsub.Close()
+}
+
+// GetContext returns value from local cache, else from remote cache
+func (c *tiered) GetContext(ctx context.Context, key string) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if v := c.local.Get(key); v != nil {
+		c.stats.hit(key, true)
+		return v, nil
+	}
+	v, err := c.remote.GetContext(ctx, key)
+	if err == ValueNotExistError {
+		c.stats.hit(key, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.stats.hit(key, true)
+	c.setLocal(key, v, 0)
+	return v, nil
+}
+
+// SetContext writes value to both caches and evicts local copies of other processes
+func (c *tiered) SetContext(ctx context.Context, key string, val interface{}, ttl time.Duration) error {
+	if err := c.remote.SetContext(ctx, key, val, ttl); err != nil {
+		return err
+	}
+	c.setLocal(key, val, ttl)
+	c.broadcast(key)
+	return nil
+}
+
+// DeleteContext deletes key from both caches and evicts local copies of other processes
+func (c *tiered) DeleteContext(ctx context.Context, key string) error {
+	if err := c.remote.DeleteContext(ctx, key); err != nil {
+		return err
+	}
+	c.local.Delete(key)
+	c.broadcast(key)
+	return nil
+}
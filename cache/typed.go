@@ -0,0 +1,140 @@
+//go:build go1.18
+// +build go1.18
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"time"
+)
+
+// TypedCache stores values of type T encoded with codec on top of Cache,
+// every call accepts context and returns error:
+// miss is reported as ValueNotExistError, decoding failure as *DecodeError
+// and backend failure as *BackendError
+type TypedCache[T any] struct {
+	cache ContextCache
+	codec Codec
+	group flightGroup
+}
+
+type typedResult[T any] struct {
+	v   T
+	err error
+}
+
+// NewTyped creates typed cache using given codec, JSONCodec is used when codec is nil
+func NewTyped[T any](c Cache, codec Codec) *TypedCache[T] {
+	if codec == nil {
+		codec = JSONCodec
+	}
+	cc, ok := c.(ContextCache)
+	if !ok {
+		cc = contextAdapter{c}
+	}
+	return &TypedCache[T]{cache: cc, codec: codec}
+}
+
+// Get returns value of key
+func (c *TypedCache[T]) Get(ctx context.Context, key string) (T, error) {
+	var zero T
+	raw, err := c.cache.GetContext(ctx, key)
+	if err != nil {
+		return zero, err
+	}
+	return c.decode(key, raw)
+}
+
+// Set encodes value and stores it, zero ttl means value never expires
+func (c *TypedCache[T]) Set(ctx context.Context, key string, v T, ttl time.Duration) error {
+	data, err := c.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.cache.SetContext(ctx, key, data, ttl)
+}
+
+// GetOrElse returns value of key, when key does not exist value is loaded by loader and stored,
+// decoding failure is treated as miss so broken value is replaced, backend failure is returned.
+// Concurrent misses of the same key share one loader call
+func (c *TypedCache[T]) GetOrElse(ctx context.Context, key string, loader func(ctx context.Context, key string) (T, error), ttl time.Duration) (T, error) {
+	v, err := c.Get(ctx, key)
+	if err == nil || !c.missed(err) {
+		return v, err
+	}
+	r := c.group.do(key, func() interface{} {
+		// value may be loaded by previous call while this one waited
+		if v, err := c.Get(ctx, key); err == nil || !c.missed(err) {
+			return typedResult[T]{v, err}
+		}
+		v, err := loader(ctx, key)
+		if err == nil {
+			err = c.Set(ctx, key, v, ttl)
+		}
+		return typedResult[T]{v, err}
+	}).(typedResult[T])
+	return r.v, r.err
+}
+
+func (c *TypedCache[T]) missed(err error) bool {
+	var decodeErr *DecodeError
+	return errors.Is(err, ValueNotExistError) || errors.As(err, &decodeErr)
+}
+
+// Delete deletes key, deleting missing key is not an error
+func (c *TypedCache[T]) Delete(ctx context.Context, key string) error {
+	return c.cache.DeleteContext(ctx, key)
+}
+
+// GetMulti returns values of keys which exist, missing keys are not included in result
+func (c *TypedCache[T]) GetMulti(ctx context.Context, keys []string) (map[string]T, error) {
+	values := make(map[string]T, len(keys))
+	for _, key := range keys {
+		v, err := c.Get(ctx, key)
+		if errors.Is(err, ValueNotExistError) {
+			continue
+		}
+		if err != nil {
+			return values, err
+		}
+		values[key] = v
+	}
+	return values, nil
+}
+
+func (c *TypedCache[T]) decode(key string, raw interface{}) (T, error) {
+	var data []byte
+	switch r := raw.(type) {
+	case []byte:
+		data = r
+	case string:
+		data = []byte(r)
+	default:
+		// value stored through untyped api
+		v, ok := raw.(T)
+		if !ok {
+			return v, &DecodeError{Key: key, Err: InvalidValueTypeError}
+		}
+		return v, nil
+	}
+	v, target := newTarget[T]()
+	if err := c.codec.Unmarshal(data, target); err != nil {
+		var zero T
+		return zero, &DecodeError{Key: key, Err: err}
+	}
+	return *v, nil
+}
+
+// newTarget returns value to decode into and argument for Codec.Unmarshal,
+// when T is pointer (eg: proto message), value is allocated so codec receives *Message instead of **Message
+func newTarget[T any]() (*T, interface{}) {
+	v := new(T)
+	if t := reflect.TypeOf(v).Elem(); t.Kind() == reflect.Ptr {
+		elem := reflect.New(t.Elem())
+		reflect.ValueOf(v).Elem().Set(elem)
+		return v, elem.Interface()
+	}
+	return v, v
+}
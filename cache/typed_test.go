@@ -0,0 +1,111 @@
+//go:build go1.18
+// +build go1.18
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type user struct {
+	Name string
+	Age  int
+}
+
+func TestTypedCache(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	var (
+		ctx    = context.Background()
+		caches = map[string]Cache{
+			"memory": NewMemoryCache(Config{GcDuration: 60}),
+			"redis":  NewRedis(server.Addr(), ""),
+		}
+		codecs = map[string]Codec{"json": JSONCodec, "gob": GobCodec, "msgpack": MsgpackCodec}
+		want   = user{Name: "denny", Age: 3}
+	)
+	for name, c := range caches {
+		for codecName, codec := range codecs {
+			typed := NewTyped[user](c, codec)
+			key := name + codecName
+			if _, err := typed.Get(ctx, key); !errors.Is(err, ValueNotExistError) {
+				t.Errorf("%s/%s: expect miss, got %v", name, codecName, err)
+			}
+			if err := typed.Set(ctx, key, want, time.Minute); err != nil {
+				t.Fatal(err)
+			}
+			if got, err := typed.Get(ctx, key); err != nil || got != want {
+				t.Errorf("%s/%s: got %v, %v", name, codecName, got, err)
+			}
+			calls := 0
+			loader := func(ctx context.Context, key string) (user, error) {
+				calls++
+				return want, nil
+			}
+			_ = typed.Delete(ctx, key)
+			for i := 0; i < 2; i++ {
+				if got, err := typed.GetOrElse(ctx, key, loader, 0); err != nil || got != want {
+					t.Errorf("%s/%s: got %v, %v", name, codecName, got, err)
+				}
+			}
+			if calls != 1 {
+				t.Errorf("%s/%s: loader called %d times", name, codecName, calls)
+			}
+		}
+
+		c.Set("broken", "{", 0)
+		var decodeErr *DecodeError
+		if _, err := NewTyped[user](c, JSONCodec).Get(ctx, "broken"); !errors.As(err, &decodeErr) {
+			t.Errorf("%s: expect decode error, got %v", name, err)
+		}
+	}
+
+	server.Close()
+	var backendErr *BackendError
+	if _, err := NewTyped[user](caches["redis"], nil).Get(ctx, "key"); !errors.As(err, &backendErr) {
+		t.Errorf("expect backend error, got %v", err)
+	}
+}
+
+func TestTypedCachePointer(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	var (
+		ctx    = context.Background()
+		caches = map[string]Cache{
+			"memory": NewMemoryCache(Config{GcDuration: 60}),
+			"redis":  NewRedis(server.Addr(), ""),
+		}
+	)
+	for name, c := range caches {
+		messages := NewTyped[*wrapperspb.StringValue](c, ProtoCodec)
+		if err := messages.Set(ctx, "proto", wrapperspb.String("denny"), time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := messages.Get(ctx, "proto"); err != nil || got.GetValue() != "denny" {
+			t.Errorf("%s: got %v, %v", name, got, err)
+		}
+
+		users := NewTyped[*user](c, JSONCodec)
+		if err := users.Set(ctx, "user", &user{Name: "denny", Age: 3}, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := users.Get(ctx, "user"); err != nil || got == nil || *got != (user{Name: "denny", Age: 3}) {
+			t.Errorf("%s: got %v, %v", name, got, err)
+		}
+	}
+}
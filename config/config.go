@@ -7,6 +7,7 @@ import (
 	"github.com/whatvn/denny/go_config/source/env"
 	"github.com/whatvn/denny/go_config/source/etcd"
 	"github.com/whatvn/denny/go_config/source/file"
+	"github.com/whatvn/denny/log"
 	"os"
 )
 
@@ -52,6 +53,30 @@ func Watch() (goconfig.Watcher, error) {
 	return cfg.Watch()
 }
 
+// WatchLogLevel sets level of log backend (default backend when nil) from config value at given path
+// and keeps it in sync whenever config changes until returned watcher is stopped
+func WatchLogLevel(backend log.Backend, path ...string) (goconfig.Watcher, error) {
+	apply := func() {
+		if level, err := log.ParseLevel(GetString(path...)); err == nil {
+			_ = log.SetLevel(backend, level)
+		}
+	}
+	w, err := cfg.Watch()
+	if err != nil {
+		return nil, err
+	}
+	apply()
+	go func() {
+		for {
+			if _, err := w.Next(); err != nil {
+				return
+			}
+			apply()
+		}
+	}()
+	return w, nil
+}
+
 func Reload() error {
 	return cfg.Sync()
 }
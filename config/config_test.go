@@ -7,6 +7,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/whatvn/denny/log"
 )
 
 func createFileForTest(t *testing.T) *os.File {
@@ -154,3 +156,43 @@ func TestWithScanToPointer(t *testing.T) {
 		t.Fatalf("Expected jenny error but got %v", v)
 	}
 }
+
+func TestWatchLogLevel(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("file.%d", time.Now().UnixNano()))
+	defer os.Remove(path)
+	if err := os.WriteFile(path, []byte(`{"log": {"level": "debug"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(path); err != nil {
+		t.Fatal(err)
+	}
+	backend := log.NewLogrus(log.Config{Level: log.InfoLevel})
+	w, err := WatchLogLevel(backend, "log", "level")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	if level, _ := log.GetLevel(backend); level != log.DebugLevel {
+		t.Fatalf("expect debug level, got %s", level)
+	}
+
+	// give file source time to start watching, then write same length content in place
+	// so watcher never reads a truncated file
+	time.Sleep(200 * time.Millisecond)
+	fh, err := os.OpenFile(path, os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = fh.Write([]byte(`{"log": {"level": "error"}}`))
+	fh.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		if level, _ := log.GetLevel(backend); level == log.ErrorLevel {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatal("expect level to follow config change")
+}
@@ -7,7 +7,7 @@ import (
 
 type controller interface {
 	Handle(*Context)
-	init()
+	init(*Context)
 	SetValidator(validator binding.StructValidator)
 }
 
@@ -16,8 +16,8 @@ type Controller struct {
 	*log.Log
 }
 
-func (c *Controller) init() {
-	c.Log = log.New()
+func (c *Controller) init(ctx *Context) {
+	c.Log = log.NewWithContext(ctx.Request.Context())
 	c.StructValidator = binding.Validator
 }
 
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
 	"net"
@@ -24,6 +25,11 @@ import (
 	"github.com/whatvn/denny/log"
 	"github.com/whatvn/denny/middleware"
 	"github.com/whatvn/denny/naming"
+	"github.com/whatvn/denny/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
 )
 
@@ -35,11 +41,12 @@ type (
 		handler HandleFunc
 	}
 	group struct {
-		path        string
-		cors        bool
-		routerGroup *gin.RouterGroup
-		handlerMap  map[string]*methodHandlerMap
-		engine      *Denny
+		path          string
+		cors          bool
+		serviceRoutes bool
+		routerGroup   *gin.RouterGroup
+		handlerMap    map[string]*methodHandlerMap
+		engine        *Denny
 	}
 
 	Denny struct {
@@ -54,7 +61,13 @@ type (
 		noMethodHandler HandleFunc
 		grpcServer      *grpc.Server
 		// for naming registry/dicovery
-		registry naming.Registry
+		logBackend           log.Backend
+		logLevelOverride     *log.LevelOverride
+		telemetry            *tracing.Telemetry
+		registry             naming.Registry
+		healthProbe          naming.HealthProbe
+		serviceRegistrations map[string]ServiceRegistration
+		advertise            advertise
 	}
 
 	ProtoJsonSerializer func(response interface{}) (interface{}, error)
@@ -125,12 +138,66 @@ func AddProtoJsonResponseSerializer(parserFunc ProtoJsonSerializer) {
 	brpcHTTPResponseParser = parserFunc
 }
 
+// WithLogger sets backend of every logger created while serving requests of this Denny instance:
+// GetLogger, Controller logger and built-in logging middleware/interceptor
+func (r *Denny) WithLogger(backend log.Backend) *Denny {
+	r.logBackend = backend
+	r.Log = log.NewWithBackend(backend)
+	return r
+}
+
+// WithLogLevelOverride lets clients from allowed IPs/CIDRs change log level of their own requests
+// by sending level name in given http header/grpc metadata key (log.DefaultOverrideKey when empty),
+// it's honored by built-in logging middleware and interceptor. client address is address of connection,
+// X-Forwarded-For and X-Real-Ip headers are not trusted, so proxies must be listed to allow their clients
+func (r *Denny) WithLogLevelOverride(key string, allow ...string) *Denny {
+	override, err := log.NewLevelOverride(key, allow...)
+	if err != nil {
+		panic(err)
+	}
+	r.logLevelOverride = override
+	return r
+}
+
+// WithLogLevelHandler registers http endpoint at given path which reports log level on GET
+// and changes it on PUT/POST at runtime, see log.LevelHandler.
+// endpoint changes log level of whole process, so auth handler is required, it runs before
+// the endpoint and must abort requests which are not allowed to change level
+func (r *Denny) WithLogLevelHandler(path string, auth HandleFunc) *Denny {
+	if auth == nil {
+		panic("log level handler requires auth handler")
+	}
+	handler := gin.WrapF(func(w http.ResponseWriter, req *http.Request) {
+		log.LevelHandler(r.logBackend).ServeHTTP(w, req)
+	})
+	r.GET(path, auth, handler)
+	r.PUT(path, auth, handler)
+	r.POST(path, auth, handler)
+	return r
+}
+
+// WithTelemetry makes grpc server created by Denny.NewGrpcServer, otel.RequestTracer http middleware
+// and brpc calls trace requests with OpenTelemetry providers of given telemetry,
+// grpc server uses opentracing when telemetry is not set
+func (r *Denny) WithTelemetry(telemetry *tracing.Telemetry) *Denny {
+	r.telemetry = telemetry
+	return r
+}
+
 // WithRegistry makes Denny discoverable via naming registry
 func (r *Denny) WithRegistry(registry naming.Registry) *Denny {
 	r.registry = registry
 	return r
 }
 
+// WithHealthProbe sets probe which registry runs before refreshing registered address,
+// when probe fails, address is marked unhealthy and clients stop routing to it until probe succeeds again.
+// it's only applied to registries which implement naming.HealthReporter
+func (r *Denny) WithHealthProbe(probe naming.HealthProbe) *Denny {
+	r.healthProbe = probe
+	return r
+}
+
 // WithGrpcServer turns Denny into grpc server
 func (r *Denny) WithGrpcServer(server *grpc.Server) *Denny {
 	if server == nil {
@@ -150,7 +217,7 @@ func (r *Denny) Controller(path string, method HttpMethod, ctl controller) *Denn
 	m := &methodHandlerMap{
 		method: method,
 		handler: func(ctx *Context) {
-			ctl.init()
+			ctl.init(ctx)
 			ctl.Handle(ctx)
 		},
 	}
@@ -184,7 +251,7 @@ func (g *group) Controller(path string, method HttpMethod, ctl controller) *grou
 	m := &methodHandlerMap{
 		method: method,
 		handler: func(ctx *Context) {
-			ctl.init()
+			ctl.init(ctx)
 			ctl.Handle(ctx)
 		},
 	}
@@ -223,17 +290,41 @@ func httpRouterPath(controllerName string, method reflect.Method) string {
 }
 
 // BrpcController register a grpc service implements as multiple http enpoints
-// endpoint usually start with service name (class name), and end with method name
+// endpoint usually start with service name, and end with method name
 // so if your have your service name: Greeting and have method hi, when registered with server
 // under group v1, your http endpoint will be /v1/greeting/hi
-func (g *group) BrpcController(controllerGroup interface{}) {
-	g.registerHttpController(controllerGroup)
+//
+// only rpc methods of service are registered, service is described by given grpc.ServiceDesc
+// (eg: pb.HelloService_serviceDesc) or discovered among services registered to grpc server attached to Denny,
+// when service is unknown, every exported method of controller is registered.
+// endpoint starts with controller type name, see WithServiceRoutes to use proto service name instead.
+// invalid controller is reported as error and none of its methods is registered, callers must check it
+func (g *group) BrpcController(controllerGroup interface{}, desc ...*grpc.ServiceDesc) error {
+	if len(desc) > 0 && desc[0] != nil {
+		service, err := serviceFromDesc(desc[0], controllerGroup)
+		if err != nil {
+			return err
+		}
+		return g.registerBrpcService(controllerGroup, service)
+	}
+	if service, ok, err := g.engine.discoverService(controllerGroup); err != nil {
+		return err
+	} else if ok {
+		return g.registerBrpcService(controllerGroup, service)
+	}
+	return g.registerHttpController(controllerGroup)
 }
 
 func (g *group) WithCors() {
 	g.cors = true
 }
 
+// WithServiceRoutes makes endpoints of grpc services registered by BrpcController start with
+// proto service name without "Service" suffix instead of controller type name: pb.HelloService -> /hello
+func (g *group) WithServiceRoutes() {
+	g.serviceRoutes = true
+}
+
 func cors() HandleFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", c.Request.Header.Get("Origin"))
@@ -250,57 +341,111 @@ func cors() HandleFunc {
 	}
 }
 
-func (g *group) registerHttpController(controllerGroup interface{}) {
+func (g *group) registerHttpController(controllerGroup interface{}) error {
 	var (
 		controllerReferenceType              = reflect.TypeOf(controllerGroup)
 		controllerReferenceValue             = reflect.ValueOf(controllerGroup)
 		indirectControllerReferenceValueType = reflect.Indirect(controllerReferenceValue).Type()
 		controllerName                       = indirectControllerReferenceValueType.Name()
 	)
+	// validate every method before installing any of them
+	for m := 0; m < controllerReferenceType.NumMethod(); m++ {
+		if err := validateMethod(controllerName, controllerReferenceType.Method(m)); err != nil {
+			return err
+		}
+	}
 	// Install the methods
 	for m := 0; m < controllerReferenceType.NumMethod(); m++ {
-
 		method := controllerReferenceType.Method(m)
-
-		if method.Type.NumIn() != 3 {
-			panic(invalidMethodType)
+		routerPath, httpMethod := httpRouterPath(controllerName, method), httpMethod(method)
+		fullMethod := func() string {
+			return g.engine.grpcFullMethod(controllerName, method.Name)
 		}
-
-		groupType, contextType, requestType := method.Type.In(0), method.Type.In(1), method.Type.In(2)
-
-		if groupType.Kind() != reflect.Ptr {
-			panic(invalidMethodType)
+		if err := g.registerHandler(controllerReferenceValue, method, routerPath, httpMethod, fullMethod); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		if contextType.Kind() != reflect.Ptr && contextType.Kind() != reflect.Interface {
-			panic(invalidMethodType)
+// registerBrpcService registers rpc methods of known grpc service
+func (g *group) registerBrpcService(controllerGroup interface{}, service *brpcService) error {
+	var (
+		controllerReferenceType  = reflect.TypeOf(controllerGroup)
+		controllerReferenceValue = reflect.ValueOf(controllerGroup)
+		controllerName           = reflect.Indirect(controllerReferenceValue).Type().Name()
+		methods                  = make([]reflect.Method, 0, len(service.methods))
+	)
+	if g.serviceRoutes {
+		controllerName = service.routeName()
+	}
+	for _, name := range service.methods {
+		method, ok := controllerReferenceType.MethodByName(name)
+		if !ok {
+			return fmt.Errorf("%w: %s does not implement rpc %s/%s", invalidMethodType, controllerReferenceType, service.name, name)
 		}
-
-		if !contextType.Implements(underlyContextType) {
-			panic(invalidMethodType)
+		if err := validateMethod(controllerReferenceType.String(), method); err != nil {
+			return err
 		}
-
-		if requestType.Kind() != reflect.Ptr {
-			panic(invalidMethodType)
+		methods = append(methods, method)
+	}
+	for _, method := range methods {
+		var (
+			routerPath = httpRouterPath(controllerName, method)
+			fullMethod = "/" + service.name + "/" + method.Name
+		)
+		err := g.registerHandler(controllerReferenceValue, method, routerPath, httpMethod(method), func() string {
+			return fullMethod
+		})
+		if err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		if method.Type.NumOut() != 2 {
-			panic(invalidMethodType)
-		}
+// validateMethod checks that method has grpc unary method signature:
+// func (s *Service) Method(context.Context, *Request) (*Response, error)
+func validateMethod(controllerName string, method reflect.Method) error {
+	invalid := func(reason string) error {
+		return fmt.Errorf("%w: %s.%s %s, expect func(context.Context, *Request) (*Response, error)",
+			invalidMethodType, controllerName, method.Name, reason)
+	}
+	if method.Type.NumIn() != 3 {
+		return invalid(fmt.Sprintf("has %d arguments", method.Type.NumIn()-1))
+	}
 
-		outErrorType, outResponseType := method.Type.Out(1), method.Type.Out(0)
-		if outErrorType != underlyErrorType {
-			panic(invalidMethodType)
-		}
+	groupType, contextType, requestType := method.Type.In(0), method.Type.In(1), method.Type.In(2)
 
-		if outResponseType.Kind() != reflect.Ptr {
-			panic(invalidMethodType)
-		}
+	if groupType.Kind() != reflect.Ptr {
+		return invalid("has non pointer receiver")
+	}
 
-		routerPath, httpMethod := httpRouterPath(controllerName, method), httpMethod(method)
-		g.registerHandler(controllerReferenceValue, method, routerPath, httpMethod)
+	if contextType.Kind() != reflect.Ptr && contextType.Kind() != reflect.Interface {
+		return invalid("first argument is not a context")
+	}
+
+	if !contextType.Implements(underlyContextType) {
+		return invalid("first argument is not a context")
+	}
+
+	if requestType.Kind() != reflect.Ptr {
+		return invalid("request is not a pointer")
+	}
 
+	if method.Type.NumOut() != 2 {
+		return invalid(fmt.Sprintf("returns %d values", method.Type.NumOut()))
 	}
+
+	outErrorType, outResponseType := method.Type.Out(1), method.Type.Out(0)
+	if outErrorType != underlyErrorType {
+		return invalid("second result is not an error")
+	}
+
+	if outResponseType.Kind() != reflect.Ptr {
+		return invalid("response is not a pointer")
+	}
+	return nil
 }
 
 func unmarshal(ctx *Context, in interface{}) error {
@@ -308,18 +453,33 @@ func unmarshal(ctx *Context, in interface{}) error {
 }
 
 // getCaller extract grpc service implementation into gin http handlerFunc
-func getCaller(fn, obj reflect.Value) (func(*gin.Context), error) {
+// when Denny has grpc server created by Denny.NewGrpcServer, call runs through its interceptor chain
+// resolveFullMethod returns full method name (/package.Service/Method) of called method
+func getCaller(fn, obj reflect.Value, engine *Denny, resolveFullMethod func() string) (func(*gin.Context), error) {
 	var (
 		funcType    = fn.Type()
 		requestType = funcType.In(2)
+		// interceptors pass their own context, so chain is only used when method accepts context.Context
+		acceptContext = funcType.In(1) == underlyContextType
+		fullMethod    string
+		resolveOnce   sync.Once
 	)
 
-	handlerFunc := func(c *gin.Context) interface{} { return c }
-
 	reqIsValue := true
 	if requestType.Kind() == reflect.Ptr {
 		reqIsValue = false
 	}
+
+	// call grpc service with provided method
+	// obj is service which implements grpc service interface
+	call := func(ctx context.Context, req interface{}) (interface{}, error) {
+		vals := fn.Call([]reflect.Value{obj, reflect.ValueOf(ctx), reflect.ValueOf(req)})
+		if err := vals[1].Interface(); err != nil {
+			return vals[0].Interface(), err.(error)
+		}
+		return vals[0].Interface(), nil
+	}
+
 	return func(c *Context) {
 		req := reflect.New(requestType)
 		if !reqIsValue {
@@ -342,61 +502,89 @@ func getCaller(fn, obj reflect.Value) (func(*gin.Context), error) {
 			}
 		}
 
-		var vals []reflect.Value
-		// call grpc service with provided method
-		// obj is service which implements grpc service interface
-		vals = fn.Call([]reflect.Value{obj, reflect.ValueOf(handlerFunc(c)), req})
+		// grpc server may be attached after controller is registered
+		resolveOnce.Do(func() {
+			fullMethod = resolveFullMethod()
+		})
+
+		// trace dispatch when Denny traces with OpenTelemetry
+		var span trace.Span
+		if t := tracing.FromContext(c.Request.Context()); t != nil {
+			var ctx context.Context
+			ctx, span = t.Tracer().Start(c.Request.Context(), "brpc "+strings.TrimPrefix(fullMethod, "/"),
+				trace.WithAttributes(brpcAttributes(fullMethod)...))
+			defer span.End()
+			c.Request = c.Request.WithContext(ctx)
+		}
 
-		if vals != nil {
-			response, err := vals[0].Interface(), vals[1].Interface()
-			if err != nil {
-				_ = c.AbortWithError(http.StatusInternalServerError, err.(error))
-				return
+		var (
+			response interface{}
+			err      error
+		)
+		if chain, ok := engine.grpcChain(); ok && acceptContext {
+			ctx, stream := newBrpcContext(c, fullMethod)
+			info := &grpc.UnaryServerInfo{Server: obj.Interface(), FullMethod: fullMethod}
+			response, err = chain(ctx, req.Interface(), info, call)
+			stream.writeMetadata(c)
+		} else {
+			response, err = call(c, req.Interface())
+		}
+
+		if err != nil {
+			if span != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
 			}
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
 
-			if brpcHTTPResponseParser != nil {
-				res, err := brpcHTTPResponseParser(response)
-				if err != nil {
-					_ = c.AbortWithError(http.StatusInternalServerError, err)
-					return
-				}
-				c.JSON(http.StatusOK, res)
+		if brpcHTTPResponseParser != nil {
+			res, err := brpcHTTPResponseParser(response)
+			if err != nil {
+				_ = c.AbortWithError(http.StatusInternalServerError, err)
 				return
 			}
-
-			c.JSON(http.StatusOK, response)
+			c.JSON(http.StatusOK, res)
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{})
+
+		c.JSON(http.StatusOK, response)
 	}, nil
 }
 
-func handlerFuncObj(function, obj reflect.Value) gin.HandlerFunc {
-	call, err := getCaller(function, obj)
-	if err != nil {
-		panic(err)
+func brpcAttributes(fullMethod string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{semconv.RPCSystemKey.String("brpc")}
+	name := strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		attrs = append(attrs, semconv.RPCServiceKey.String(name[:i]), semconv.RPCMethodKey.String(name[i+1:]))
 	}
+	return attrs
+}
 
-	return call
+func handlerFuncObj(function, obj reflect.Value, engine *Denny, fullMethod func() string) (gin.HandlerFunc, error) {
+	return getCaller(function, obj, engine, fullMethod)
 }
 
 func (g *group) registerHandler(
 	controllerReferenceValue reflect.Value,
-	method reflect.Method, path string, httpMethod HttpMethod) {
-	handlerFunc := handlerFuncObj(method.Func, controllerReferenceValue)
+	method reflect.Method, path string, httpMethod HttpMethod, fullMethod func() string) error {
+	handlerFunc, err := handlerFuncObj(method.Func, controllerReferenceValue, g.engine, fullMethod)
+	if err != nil {
+		return err
+	}
 	if g.cors {
 		g.routerGroup.OPTIONS(path, cors())
 	}
 	switch httpMethod {
 	case HttpPost:
 		g.routerGroup.POST(path, cors(), handlerFunc)
-		break
 	case HttpGet:
 		g.routerGroup.GET(path, cors(), handlerFunc)
-		break
 	default:
-		panic("not implemetation")
+		return fmt.Errorf("http method %s is not supported by brpc controller", httpMethod)
 	}
+	return nil
 }
 
 func (r *Denny) initRoute() {
@@ -437,6 +625,15 @@ func setupHandler(m *methodHandlerMap, router gin.IRouter, p string) {
 // ServeHTTP conforms to the http.Handler interface.
 func (r *Denny) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	r.initRoute()
+	if r.logBackend != nil {
+		req = req.WithContext(log.WithBackend(req.Context(), r.logBackend))
+	}
+	if r.logLevelOverride != nil {
+		req = req.WithContext(log.WithLevelOverride(req.Context(), r.logLevelOverride))
+	}
+	if r.telemetry != nil {
+		req = req.WithContext(tracing.WithTelemetry(req.Context(), r.telemetry))
+	}
 	r.Engine.ServeHTTP(w, req)
 }
 
@@ -482,7 +679,7 @@ func (r *Denny) GraceFulStart(addrs ...string) error {
 		muxer        cmux.CMux
 		err          error
 		addr         = r.resolveAddress(addrs)
-		ip           string
+		registerAddr string
 	)
 
 	r.initRoute()
@@ -496,11 +693,18 @@ func (r *Denny) GraceFulStart(addrs ...string) error {
 
 		// register service into registered registry
 		if r.registry != nil {
-			ip, err = localIp()
+			adv, err := r.advertise.withEnv()
 			if err != nil {
 				panic(err)
 			}
-			if err = r.registry.Register(ip+addr, 5); err != nil {
+			registerAddr, err = adv.address(addr, listener.Addr())
+			if err != nil {
+				panic(err)
+			}
+			if reporter, ok := r.registry.(naming.HealthReporter); ok && r.healthProbe != nil {
+				reporter.SetHealthProbe(r.healthProbe)
+			}
+			if err = r.register(registerAddr); err != nil {
 				panic(err)
 			}
 		}
@@ -567,7 +771,7 @@ func (r *Denny) GraceFulStart(addrs ...string) error {
 
 	if r.registry != nil {
 		r.Infof("unregister from registry")
-		_ = r.registry.UnRegister(ip + addr)
+		r.unregister(registerAddr)
 	}
 	if r.grpcServer != nil {
 		r.Infof("stop grpc server")
@@ -597,21 +801,3 @@ func (r *Denny) resolveAddress(addr []string) string {
 		panic("too many parameters")
 	}
 }
-
-func localIp() (string, error) {
-	addrs, err := net.InterfaceAddrs()
-	if err != nil {
-		return "", err
-	}
-
-	for _, a := range addrs {
-		if ipnet, ok := a.(*net.IPNet); ok &&
-			!ipnet.IP.IsLoopback() {
-			ipv4 := ipnet.IP.To4()
-			if ipv4 != nil && strings.Index(ipv4.String(), "127") != 0 {
-				return ipv4.String(), nil
-			}
-		}
-	}
-	return "", errors.New("cannot lookup local ip address")
-}
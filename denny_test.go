@@ -3,6 +3,7 @@ package denny
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/golang/protobuf/ptypes/empty"
 	"github.com/opentracing/opentracing-go"
@@ -11,13 +12,17 @@ import (
 	"github.com/whatvn/denny/middleware/grpc"
 	"github.com/whatvn/denny/naming"
 	"github.com/whatvn/denny/naming/etcd"
+	"github.com/whatvn/denny/naming/static"
 	"go.etcd.io/etcd/clientv3"
 	grpcClient "google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/types/known/timestamppb"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
 	"time"
@@ -130,7 +135,7 @@ func TestCustomJsonMarshal(t *testing.T) {
 
 	//// then http
 	authorized := server.NewGroup("/")
-	authorized.BrpcController(&Hello{})
+	assert.Nil(t, authorized.BrpcController(&Hello{}))
 
 	// RUN
 	w := performRequest(server, "GET", "/hello/say-hello-anonymous")
@@ -186,7 +191,7 @@ func TestNaming(t *testing.T) {
 
 	//// then http
 	authorized := server.NewGroup("/")
-	authorized.BrpcController(&Hello{})
+	assert.Nil(t, authorized.BrpcController(&Hello{}))
 
 	// RUN
 	clientCfgServer := clientv3.Config{
@@ -218,3 +223,205 @@ func TestNaming(t *testing.T) {
 	fmt.Println(response, err)
 	assert.Equal(t, "hoho", response.Reply)
 }
+
+func TestAdvertiseAddress(t *testing.T) {
+	var (
+		bound = &net.TCPAddr{IP: net.IPv4zero, Port: 34567}
+		local = advertise{}
+	)
+	ip, err := local.localIp()
+	if err != nil {
+		t.Skip("no usable network interface", err)
+	}
+
+	tests := []struct {
+		adv    advertise
+		listen string
+		expect string
+	}{
+		{advertise{}, ":8080", net.JoinHostPort(ip, "8080")},
+		{advertise{}, "0.0.0.0:8080", net.JoinHostPort(ip, "8080")},
+		{advertise{}, "[::]:8080", net.JoinHostPort(ip, "8080")},
+		{advertise{}, ":0", net.JoinHostPort(ip, "34567")},
+		{advertise{}, "10.0.0.5:8080", "10.0.0.5:8080"},
+		{advertise{}, "[fd00::5]:8080", "[fd00::5]:8080"},
+		{advertise{}, "svc.local:8080", "svc.local:8080"},
+		{advertise{addr: "192.168.1.10"}, ":8080", "192.168.1.10:8080"},
+		{advertise{addr: "192.168.1.10:9090"}, ":8080", "192.168.1.10:9090"},
+		{advertise{addr: "fd00::10"}, ":8080", "[fd00::10]:8080"},
+		{advertise{addr: "[fd00::10]"}, ":8080", "[fd00::10]:8080"},
+	}
+	for _, tt := range tests {
+		addr, err := tt.adv.address(tt.listen, bound)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, tt.expect, addr, tt.listen)
+	}
+
+	// cidr rule selects matching ip only
+	nets, err := parseCIDRs([]string{ip + "/32"})
+	assert.Equal(t, nil, err)
+	addr, err := advertise{cidrs: nets}.address(":8080", bound)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, net.JoinHostPort(ip, "8080"), addr)
+	nets, _ = parseCIDRs([]string{"0.0.0.0/32"})
+	_, err = advertise{cidrs: nets}.address(":8080", bound)
+	assert.NotEqual(t, nil, err)
+
+	os.Setenv(EnvAdvertiseAddr, "172.16.0.1")
+	defer os.Unsetenv(EnvAdvertiseAddr)
+	adv, err := advertise{addr: "192.168.1.10"}.withEnv()
+	assert.Equal(t, nil, err)
+	addr, _ = adv.address(":8080", bound)
+	assert.Equal(t, "172.16.0.1:8080", addr)
+}
+
+type serviceRegistry struct {
+	naming.Registry
+	services map[string]naming.Service
+}
+
+func (s *serviceRegistry) RegisterService(svc naming.Service) error {
+	s.services[svc.Name] = svc
+	return nil
+}
+
+func (s *serviceRegistry) UnRegisterService(name, addr string) error {
+	delete(s.services, name)
+	return nil
+}
+
+func TestServiceRegistration(t *testing.T) {
+	var (
+		server     = NewServer()
+		grpcServer = NewGrpcServer()
+		registry   = &serviceRegistry{
+			Registry: static.New("demo.svc"),
+			services: make(map[string]naming.Service),
+		}
+	)
+	pb.RegisterHelloServiceServer(grpcServer, new(Hello))
+	server.WithGrpcServer(grpcServer).WithRegistry(registry)
+
+	assert.Equal(t, nil, server.register("10.0.0.1:8080"))
+	svc, ok := registry.services["pb.HelloService"]
+	assert.Equal(t, true, ok)
+	assert.Equal(t, naming.Service{Name: "pb.HelloService", Addr: "10.0.0.1:8080", TTL: defaultRegistryTTL}, svc)
+	server.unregister("10.0.0.1:8080")
+	assert.Equal(t, 0, len(registry.services))
+
+	server.WithServiceRegistration("pb.HelloService", ServiceRegistration{
+		Name:     "hello",
+		TTL:      10,
+		Metadata: map[string]string{"version": "v2"},
+	})
+	assert.Equal(t, nil, server.register("10.0.0.1:8080"))
+	assert.Equal(t, naming.Service{Name: "hello", Addr: "10.0.0.1:8080", TTL: 10,
+		Metadata: map[string]string{"version": "v2"}}, registry.services["hello"])
+
+	server.WithServiceRegistration("pb.HelloService", ServiceRegistration{Skip: true})
+	assert.Equal(t, 0, len(server.services("10.0.0.1:8080")))
+}
+
+func TestBrpcInterceptorChain(t *testing.T) {
+	var (
+		fullMethod string
+		requestID  string
+	)
+	server := NewServer(true)
+	grpcServer := server.NewGrpcServer(func(ctx context.Context, req interface{}, info *grpcClient.UnaryServerInfo, handler grpcClient.UnaryHandler) (interface{}, error) {
+		fullMethod = info.FullMethod
+		if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get("x-request-id")) > 0 {
+			requestID = md.Get("x-request-id")[0]
+		}
+		_ = grpcClient.SetHeader(ctx, metadata.Pairs("x-served-by", "denny"))
+		_ = grpcClient.SetTrailer(ctx, metadata.Pairs("x-cost", "1"))
+		return handler(ctx, req)
+	})
+	pb.RegisterHelloServiceServer(grpcServer, new(Hello))
+	assert.Nil(t, server.NewGroup("/").BrpcController(&Hello{}))
+
+	w := performRequest(server, "GET", "/hello/say-hello-anonymous", header{"X-Request-Id", "abc"})
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "/pb.HelloService/SayHelloAnonymous", fullMethod)
+	assert.Equal(t, "abc", requestID)
+	assert.Equal(t, "denny", w.Header().Get("X-Served-By"))
+	assert.Equal(t, "1", w.Header().Get("Grpc-Trailer-X-Cost"))
+}
+
+func TestBrpcAttachedServerInterceptors(t *testing.T) {
+	var called bool
+	grpcServer := NewGrpcServer(func(ctx context.Context, req interface{}, info *grpcClient.UnaryServerInfo, handler grpcClient.UnaryHandler) (interface{}, error) {
+		called = true
+		return nil, fmt.Errorf("unauthenticated")
+	})
+	pb.RegisterHelloServiceServer(grpcServer, new(Hello))
+	server := NewServer(true).WithGrpcServer(grpcServer)
+	assert.Nil(t, server.NewGroup("/").BrpcController(&Hello{}))
+
+	w := performRequest(server, "GET", "/hello/say-hello-anonymous")
+
+	assert.True(t, called)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+// helloServer implements pb.HelloServiceServer and has helper method which is not rpc
+type helloServer struct {
+	Hello
+}
+
+func (s *helloServer) Greeting(name string) string {
+	return "hi " + name
+}
+
+func TestBrpcControllerServiceDesc(t *testing.T) {
+	desc := &grpcClient.ServiceDesc{
+		ServiceName: "pb.HelloService",
+		HandlerType: (*pb.HelloServiceServer)(nil),
+		Methods: []grpcClient.MethodDesc{
+			{MethodName: "SayHello"},
+			{MethodName: "SayHelloAnonymous"},
+		},
+	}
+	server := NewServer(true)
+	assert.Nil(t, server.NewGroup("/v1").BrpcController(&helloServer{}, desc))
+	w := performRequest(server, "GET", "/v1/hello-server/say-hello-anonymous")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// endpoints start with proto service name
+	service := server.NewGroup("/v3")
+	service.WithServiceRoutes()
+	assert.Nil(t, service.BrpcController(&helloServer{}, desc))
+	w = performRequest(server, "GET", "/v3/hello/say-hello-anonymous")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// without service description, helper method can not be served
+	err := NewServer(true).NewGroup("/v1").BrpcController(&helloServer{})
+	assert.True(t, errors.Is(err, invalidMethodType))
+
+	// discovered from grpc server
+	grpcServer := NewGrpcServer()
+	pb.RegisterHelloServiceServer(grpcServer, &helloServer{})
+	server = NewServer(true).WithGrpcServer(grpcServer)
+	assert.Nil(t, server.NewGroup("/v2").BrpcController(&helloServer{}))
+	w = performRequest(server, "GET", "/v2/hello-server/say-hello-anonymous")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// does not implement service
+	err = NewServer(true).NewGroup("/v1").BrpcController(&struct{}{}, desc)
+	assert.True(t, errors.Is(err, invalidMethodType))
+}
+
+func TestLogLevelHandlerAuth(t *testing.T) {
+	assert.Panics(t, func() { NewServer(true).WithLogLevelHandler("/admin/log-level", nil) })
+
+	server := NewServer(true).WithLogLevelHandler("/admin/log-level", func(ctx *Context) {
+		if ctx.GetHeader("X-Token") != "secret" {
+			ctx.AbortWithStatus(http.StatusUnauthorized)
+		}
+	})
+	w := performRequest(server, "PUT", "/admin/log-level?level=debug")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = performRequest(server, "GET", "/admin/log-level", header{"X-Token", "secret"})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -109,16 +109,17 @@ func main() {
 
 	// setup grpc server
 
-	grpcServer := denny.NewGrpcServer(grpc.ValidatorInterceptor)
+	grpcServer := server.NewGrpcServer(grpc.ValidatorInterceptor)
 	pb.RegisterHelloServiceServer(grpcServer, new(Hello))
-	server.WithGrpcServer(grpcServer)
 	//
 
 	//// then http
 	authorized := server.NewGroup("/")
 	// http://127.0.0.1:8080/hello/sayhello  (POST)
 	// http://127.0.0.1:8080/hello/sayhelloanonymous  (GET)
-	authorized.BrpcController(&Hello{})
+	if err := authorized.BrpcController(&Hello{}); err != nil {
+		panic(err)
+	}
 
 	// naming registry
 	registry := redis.New("127.0.0.1:6379", "", "demo.brpc.svc")
@@ -2,9 +2,14 @@ package denny
 
 import (
 	"context"
+	"sort"
+	"strings"
+	"sync"
 
 	grpc_opentracing "github.com/grpc-ecosystem/go-grpc-middleware/tracing/opentracing"
+	"github.com/whatvn/denny/log"
 	grpc_middleware "github.com/whatvn/denny/middleware/grpc"
+	"github.com/whatvn/denny/tracing"
 	"google.golang.org/grpc"
 )
 
@@ -41,13 +46,107 @@ func combinator(first, second grpc.UnaryServerInterceptor) grpc.UnaryServerInter
 	}
 }
 
-func NewGrpcServer(interceptors ...grpc.UnaryServerInterceptor) *grpc.Server {
+// grpcChains keeps interceptor chain of every grpc server created by NewGrpcServer,
+// brpc http calls of Denny serving that server run through it
+var grpcChains = struct {
+	sync.RWMutex
+	m map[*grpc.Server]grpc.UnaryServerInterceptor
+}{m: make(map[*grpc.Server]grpc.UnaryServerInterceptor)}
+
+// interceptor attaches Denny settings to request context
+func (r *Denny) interceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if r.logBackend != nil {
+		ctx = log.WithBackend(ctx, r.logBackend)
+	}
+	if r.logLevelOverride != nil {
+		ctx = log.WithLevelOverride(ctx, r.logLevelOverride)
+	}
+	if r.telemetry != nil {
+		ctx = tracing.WithTelemetry(ctx, r.telemetry)
+	}
+	return handler(ctx, req)
+}
+
+// grpcChain returns interceptor chain of grpc server attached to Denny,
+// it's only available for grpc server created by NewGrpcServer or Denny.NewGrpcServer
+func (r *Denny) grpcChain() (grpc.UnaryServerInterceptor, bool) {
+	if r == nil || r.grpcServer == nil {
+		return nil, false
+	}
+	grpcChains.RLock()
+	defer grpcChains.RUnlock()
+	chain, ok := grpcChains.m[r.grpcServer]
+	return chain, ok
+}
+
+// grpcFullMethod finds full method name (/package.Service/Method) of method implemented by controller
+// among services registered to grpc server attached to Denny, when several services have the method,
+// service whose name matches controller name is preferred
+func (r *Denny) grpcFullMethod(controllerName, method string) string {
+	var candidates []string
+	if r != nil && r.grpcServer != nil {
+		for service, info := range r.grpcServer.GetServiceInfo() {
+			for _, m := range info.Methods {
+				if m.Name == method {
+					candidates = append(candidates, service)
+				}
+			}
+		}
+	}
+	sort.Strings(candidates)
+	for _, service := range candidates {
+		name := service[strings.LastIndex(service, ".")+1:]
+		if name == controllerName || strings.TrimSuffix(name, "Service") == strings.TrimSuffix(controllerName, "Service") {
+			return "/" + service + "/" + method
+		}
+	}
+	if len(candidates) > 0 {
+		return "/" + candidates[0] + "/" + method
+	}
+	return "/" + controllerName + "/" + method
+}
+
+// tracingInterceptor traces call with OpenTelemetry when Denny has telemetry, otherwise with opentracing
+func tracingInterceptor() grpc.UnaryServerInterceptor {
+	opentracing := grpc_opentracing.UnaryServerInterceptor()
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if tracing.FromContext(ctx) != nil {
+			return grpc_middleware.TracingInterceptor(ctx, req, info, handler)
+		}
+		return opentracing(ctx, req, info, handler)
+	}
+}
+
+func newGrpcServer(settings grpc.UnaryServerInterceptor, interceptors ...grpc.UnaryServerInterceptor) *grpc.Server {
 	var (
 		builtinInterceptors = []grpc.UnaryServerInterceptor{
+			settings,
+			// span is started before logger so log lines carry its ids
+			tracingInterceptor(),
 			grpc_middleware.LoggerInterceptor,
-			grpc_opentracing.UnaryServerInterceptor(),
 		}
 	)
 	serverInterceptors := chainUnaryServerInterceptors(append(builtinInterceptors, interceptors...)...)
-	return grpc.NewServer(grpc.UnaryInterceptor(serverInterceptors))
+	server := grpc.NewServer(grpc.UnaryInterceptor(serverInterceptors))
+	grpcChains.Lock()
+	grpcChains.m[server] = serverInterceptors
+	grpcChains.Unlock()
+	return server
+}
+
+// NewGrpcServer creates grpc server with built-in tracing and logging interceptors, brpc http calls
+// of Denny it's attached to with WithGrpcServer run through its interceptor chain too.
+// settings of Denny instance (logger, log level override, telemetry) are not applied to it,
+// use Denny.NewGrpcServer for that
+func NewGrpcServer(interceptors ...grpc.UnaryServerInterceptor) *grpc.Server {
+	return newGrpcServer(nil, interceptors...)
+}
+
+// NewGrpcServer creates grpc server which applies settings of Denny to every request
+// and attaches it to Denny, brpc http calls run through its interceptor chain,
+// services must be registered to returned server before Denny starts
+func (r *Denny) NewGrpcServer(interceptors ...grpc.UnaryServerInterceptor) *grpc.Server {
+	server := newGrpcServer(r.interceptor, interceptors...)
+	r.grpcServer = server
+	return server
 }
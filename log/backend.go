@@ -0,0 +1,170 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Field is a key/value pair attached to a log line
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Backend writes structured log lines, implementations adapt logging libraries
+// such as logrus, zap or log/slog
+type Backend interface {
+	// Enabled reports whether a line at given level would be written
+	Enabled(level Level) bool
+	// Log writes one line even if level is not enabled (log level may be overridden per request),
+	// it must not exit or panic at FatalLevel/PanicLevel, Log takes care of that
+	Log(level Level, msg string, fields []Field)
+}
+
+// Format is output format of built-in backends
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatText Format = "text"
+)
+
+// Config configures built-in backends
+type Config struct {
+	// Backend is backend name: logrus (default), zap or slog
+	Backend string
+	Level   Level
+	Format  Format
+	// Output defaults to stderr
+	Output   io.Writer
+	Sampling *Sampling
+}
+
+// Sampling limits repeated log lines: in every Tick, first Initial lines with the same level
+// and message are written, then only every Thereafter-th line
+type Sampling struct {
+	Initial    int
+	Thereafter int
+	Tick       time.Duration
+}
+
+func (c Config) output() io.Writer {
+	if c.Output == nil {
+		return os.Stderr
+	}
+	return c.Output
+}
+
+var (
+	backendsMu sync.RWMutex
+	backends   = map[string]func(Config) Backend{
+		"":       NewLogrus,
+		"logrus": NewLogrus,
+		"zap":    NewZap,
+	}
+)
+
+// RegisterBackend makes a backend available to NewBackend by name
+func RegisterBackend(name string, factory func(Config) Backend) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	backends[name] = factory
+}
+
+// NewBackend creates backend with given config, backend is chosen by Config.Backend
+func NewBackend(cfg Config) (Backend, error) {
+	backendsMu.RLock()
+	factory, ok := backends[cfg.Backend]
+	backendsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown log backend: %q", cfg.Backend)
+	}
+	return factory(cfg), nil
+}
+
+// withSampling wraps backend if sampling is configured
+func withSampling(b Backend, s *Sampling) Backend {
+	if s == nil || s.Tick <= 0 {
+		return b
+	}
+	return &sampled{Backend: b, cfg: *s, counts: make(map[sampleKey]int)}
+}
+
+type sampleKey struct {
+	level Level
+	msg   string
+}
+
+type sampled struct {
+	Backend
+	sync.Mutex
+	cfg    Sampling
+	reset  time.Time
+	counts map[sampleKey]int
+}
+
+func (s *sampled) Log(level Level, msg string, fields []Field) {
+	if level <= FatalLevel {
+		// never drop lines which stop the process
+		s.Backend.Log(level, msg, fields)
+		return
+	}
+	s.Lock()
+	now := time.Now()
+	if now.Sub(s.reset) >= s.cfg.Tick {
+		s.reset = now
+		s.counts = make(map[sampleKey]int)
+	}
+	key := sampleKey{level, msg}
+	s.counts[key]++
+	n := s.counts[key]
+	s.Unlock()
+
+	if n > s.cfg.Initial && (s.cfg.Thereafter <= 0 || (n-s.cfg.Initial)%s.cfg.Thereafter != 0) {
+		return
+	}
+	s.Backend.Log(level, msg, fields)
+}
+
+var (
+	defaultMu sync.RWMutex
+	// stdBackend writes to logrus standard logger, it's default backend until SetDefault is called
+	stdBackend     = NewLogrusFrom(nil)
+	defaultBackend = stdBackend
+)
+
+// SetDefault replaces backend used by New and by requests which are not served
+// by a Denny instance with its own backend
+func SetDefault(b Backend) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultBackend = b
+}
+
+// Default returns default backend, it writes to logrus standard logger unless replaced by SetDefault
+func Default() Backend {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultBackend
+}
+
+type backendKey struct{}
+
+// WithBackend returns context carrying given backend, loggers created by NewWithContext use it
+func WithBackend(ctx context.Context, b Backend) context.Context {
+	return context.WithValue(ctx, backendKey{}, b)
+}
+
+// BackendFromContext returns backend attached to context or default backend
+func BackendFromContext(ctx context.Context) Backend {
+	if ctx != nil {
+		if b, ok := ctx.Value(backendKey{}).(Backend); ok {
+			return b
+		}
+	}
+	return Default()
+}
@@ -0,0 +1,60 @@
+package log
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Level is log severity, lower value is more severe, values are the same as logrus levels
+type Level uint32
+
+const (
+	PanicLevel Level = iota
+	FatalLevel
+	ErrorLevel
+	WarnLevel
+	InfoLevel
+	DebugLevel
+	TraceLevel
+)
+
+func (l Level) String() string {
+	switch l {
+	case PanicLevel:
+		return "panic"
+	case FatalLevel:
+		return "fatal"
+	case ErrorLevel:
+		return "error"
+	case WarnLevel:
+		return "warning"
+	case InfoLevel:
+		return "info"
+	case DebugLevel:
+		return "debug"
+	case TraceLevel:
+		return "trace"
+	}
+	return "unknown"
+}
+
+// ParseLevel converts level name into Level
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(name) {
+	case "panic":
+		return PanicLevel, nil
+	case "fatal":
+		return FatalLevel, nil
+	case "error":
+		return ErrorLevel, nil
+	case "warn", "warning":
+		return WarnLevel, nil
+	case "info":
+		return InfoLevel, nil
+	case "debug":
+		return DebugLevel, nil
+	case "trace":
+		return TraceLevel, nil
+	}
+	return InfoLevel, fmt.Errorf("invalid log level: %q", name)
+}
@@ -1,9 +1,9 @@
 package log
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"github.com/sirupsen/logrus"
+	"os"
 	"sync"
 	"time"
 )
@@ -12,34 +12,59 @@ const (
 	LogKey = "DennyLogger"
 )
 
+var now = time.Now
+
+// Log collects fields of one unit of work (eg: a request) and writes them
+// as one line through its backend
 type Log struct {
-	*logrus.Entry
 	sync.Mutex
-	step int32
+	backend Backend
+	fields  []Field
+	step    int32
+	// level overrides backend level when set
+	level *Level
 }
 
-type TextFormatter = logrus.TextFormatter
-type JSONFormatter = logrus.JSONFormatter
-type Formatter = logrus.Formatter
-
-// New return a new log object with log start time
+// New return a new log object which writes to default backend,
+// when a formatter is given, a logrus backend with that formatter is used instead
 func New(formatter ...Formatter) *Log {
 	if len(formatter) > 0 {
-		logrus.SetFormatter(formatter[0])
+		logger := newLogrusLogger()
+		logger.SetFormatter(formatter[0])
+		return NewWithBackend(NewLogrusFrom(logger))
 	}
-	logTime := time.Now().Format(time.RFC3339)
-	return &Log{
-		Entry: logrus.WithField("Time", logTime),
+	return NewWithBackend(Default())
+}
+
+// NewWithBackend return a new log object which writes to given backend
+func NewWithBackend(b Backend) *Log {
+	if b == nil {
+		b = Default()
 	}
+	return &Log{backend: b}
 }
 
-// ToJsonString convert an object into json string to beautify log
-// return nil if marshalling error
-func (l *Log) ToJsonString(input interface{}) string {
-	if bytes, err := json.Marshal(input); err == nil {
-		return string(bytes)
+// NewWithContext return a new log object which writes to backend attached to context,
+// see WithBackend, ids of span in context are added to log, see WithTrace.
+// formatter is only used when neither context nor SetDefault provides a backend, like New does
+func NewWithContext(ctx context.Context, formatter ...Formatter) *Log {
+	b := BackendFromContext(ctx)
+	if b == stdBackend && len(formatter) > 0 {
+		return New(formatter...).WithTrace(ctx)
 	}
-	return ""
+	return NewWithBackend(b).WithTrace(ctx)
+}
+
+// Backend returns backend of log object
+func (l *Log) Backend() Backend {
+	return l.backend
+}
+
+// ToJsonString convert an object into json string to beautify log, sensitive fields are masked
+// and long output is truncated by default redactor, see SetRedactor
+// return empty string if marshalling error
+func (l *Log) ToJsonString(input interface{}) string {
+	return DefaultRedactor().String(input)
 }
 
 func (l *Log) addStep() int32 {
@@ -53,22 +78,137 @@ func (l *Log) addStep() int32 {
 func (l *Log) AddLog(line string, format ...interface{}) *Log {
 	step := fmt.Sprintf("STEP_%d", l.addStep())
 	if len(format) > 0 {
-		logLine := fmt.Sprintf(line, format...)
-		l.Entry = l.Entry.WithField(step, logLine)
-		return l
+		return l.WithField(step, fmt.Sprintf(line, format...))
 	}
-	l.Entry = l.Entry.WithField(step, line)
-	return l
+	return l.WithField(step, line)
 }
 
 // WithField a a new key = value to log with key = field, value = value
 func (l *Log) WithField(field string, value interface{}) *Log {
-	l.Entry = l.Entry.WithField(field, value)
+	l.Lock()
+	defer l.Unlock()
+	l.setField(field, value)
 	return l
 }
 
 // WithFields add multiple key/value to log: key1 = value1, key2 = value2
 func (l *Log) WithFields(fields map[string]interface{}) *Log {
-	l.Entry = l.Entry.WithFields(fields)
+	l.Lock()
+	defer l.Unlock()
+	for k, v := range fields {
+		l.setField(k, v)
+	}
 	return l
 }
+
+// WithError adds error to log under "error" key
+func (l *Log) WithError(err error) *Log {
+	return l.WithField("error", err)
+}
+
+// Fields returns copy of fields added to log
+func (l *Log) Fields() []Field {
+	l.Lock()
+	defer l.Unlock()
+	return append([]Field(nil), l.fields...)
+}
+
+// SetLevel overrides level of backend for this log object only,
+// eg: to get debug logs of one request
+func (l *Log) SetLevel(level Level) *Log {
+	l.Lock()
+	defer l.Unlock()
+	l.level = &level
+	return l
+}
+
+func (l *Log) enabled(level Level) bool {
+	l.Lock()
+	override := l.level
+	l.Unlock()
+	if override != nil {
+		return level <= *override
+	}
+	return l.backend.Enabled(level)
+}
+
+func (l *Log) setField(key string, value interface{}) {
+	if r := DefaultRedactor(); r.MaskFields() && r.SensitiveName(key) {
+		value = r.Mask()
+	}
+	for i := range l.fields {
+		if l.fields[i].Key == key {
+			l.fields[i].Value = value
+			return
+		}
+	}
+	l.fields = append(l.fields, Field{Key: key, Value: value})
+}
+
+func (l *Log) log(level Level, args ...interface{}) {
+	if l.enabled(level) {
+		l.backend.Log(level, fmt.Sprint(args...), l.Fields())
+	}
+	switch level {
+	case FatalLevel:
+		os.Exit(1)
+	case PanicLevel:
+		panic(fmt.Sprint(args...))
+	}
+}
+
+func (l *Log) logf(level Level, format string, args ...interface{}) {
+	if l.enabled(level) {
+		l.backend.Log(level, fmt.Sprintf(format, args...), l.Fields())
+	}
+	switch level {
+	case FatalLevel:
+		os.Exit(1)
+	case PanicLevel:
+		panic(fmt.Sprintf(format, args...))
+	}
+}
+
+func (l *Log) logln(level Level, args ...interface{}) {
+	msg := fmt.Sprintln(args...)
+	l.log(level, msg[:len(msg)-1])
+}
+
+// WithContext adds ids of span in context to log, it's kept for compatibility
+// with logrus entry which log object used to embed, see WithTrace
+func (l *Log) WithContext(ctx context.Context) *Log {
+	return l.WithTrace(ctx)
+}
+
+// Log writes message at given level, Logf and Logln are its format and line variants
+func (l *Log) Log(level Level, args ...interface{})                 { l.log(level, args...) }
+func (l *Log) Logf(level Level, format string, args ...interface{}) { l.logf(level, format, args...) }
+func (l *Log) Logln(level Level, args ...interface{})               { l.logln(level, args...) }
+
+func (l *Log) Trace(args ...interface{})                   { l.log(TraceLevel, args...) }
+func (l *Log) Tracef(format string, args ...interface{})   { l.logf(TraceLevel, format, args...) }
+func (l *Log) Debug(args ...interface{})                   { l.log(DebugLevel, args...) }
+func (l *Log) Debugf(format string, args ...interface{})   { l.logf(DebugLevel, format, args...) }
+func (l *Log) Info(args ...interface{})                    { l.log(InfoLevel, args...) }
+func (l *Log) Infof(format string, args ...interface{})    { l.logf(InfoLevel, format, args...) }
+func (l *Log) Print(args ...interface{})                   { l.log(InfoLevel, args...) }
+func (l *Log) Printf(format string, args ...interface{})   { l.logf(InfoLevel, format, args...) }
+func (l *Log) Warn(args ...interface{})                    { l.log(WarnLevel, args...) }
+func (l *Log) Warnf(format string, args ...interface{})    { l.logf(WarnLevel, format, args...) }
+func (l *Log) Warning(args ...interface{})                 { l.log(WarnLevel, args...) }
+func (l *Log) Warningf(format string, args ...interface{}) { l.logf(WarnLevel, format, args...) }
+func (l *Log) Error(args ...interface{})                   { l.log(ErrorLevel, args...) }
+func (l *Log) Errorf(format string, args ...interface{})   { l.logf(ErrorLevel, format, args...) }
+func (l *Log) Fatal(args ...interface{})                   { l.log(FatalLevel, args...) }
+func (l *Log) Fatalf(format string, args ...interface{})   { l.logf(FatalLevel, format, args...) }
+func (l *Log) Panic(args ...interface{})                   { l.log(PanicLevel, args...) }
+func (l *Log) Panicf(format string, args ...interface{})   { l.logf(PanicLevel, format, args...) }
+func (l *Log) Traceln(args ...interface{})                 { l.logln(TraceLevel, args...) }
+func (l *Log) Debugln(args ...interface{})                 { l.logln(DebugLevel, args...) }
+func (l *Log) Infoln(args ...interface{})                  { l.logln(InfoLevel, args...) }
+func (l *Log) Println(args ...interface{})                 { l.logln(InfoLevel, args...) }
+func (l *Log) Warnln(args ...interface{})                  { l.logln(WarnLevel, args...) }
+func (l *Log) Warningln(args ...interface{})               { l.logln(WarnLevel, args...) }
+func (l *Log) Errorln(args ...interface{})                 { l.logln(ErrorLevel, args...) }
+func (l *Log) Fatalln(args ...interface{})                 { l.logln(FatalLevel, args...) }
+func (l *Log) Panicln(args ...interface{})                 { l.logln(PanicLevel, args...) }
@@ -0,0 +1,285 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/sirupsen/logrus"
+	"github.com/uber/jaeger-client-go"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestBackends(t *testing.T) {
+	for _, name := range []string{"logrus", "zap", "slog"} {
+		var buf bytes.Buffer
+		b, err := NewBackend(Config{Backend: name, Level: InfoLevel, Format: FormatJSON, Output: &buf})
+		if name == "slog" && err != nil {
+			continue
+		}
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		logger := NewWithBackend(b).WithField("uri", "/hello")
+		logger.Debug("hidden")
+		logger.Info("visible")
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 1 {
+			t.Fatalf("%s: expect 1 line, got %q", name, buf.String())
+		}
+		var line map[string]interface{}
+		if err := json.Unmarshal([]byte(lines[0]), &line); err != nil {
+			t.Fatal(name, err)
+		}
+		if line["uri"] != "/hello" || !strings.Contains(lines[0], "visible") {
+			t.Fatalf("%s: unexpected line %s", name, lines[0])
+		}
+	}
+	if _, err := NewBackend(Config{Backend: "unknown"}); err == nil {
+		t.Fatal("expect error for unknown backend")
+	}
+}
+
+func TestSampling(t *testing.T) {
+	var buf bytes.Buffer
+	b := NewLogrus(Config{
+		Level:    InfoLevel,
+		Format:   FormatJSON,
+		Output:   &buf,
+		Sampling: &Sampling{Initial: 2, Thereafter: 3, Tick: time.Minute},
+	})
+	logger := NewWithBackend(b)
+	for i := 0; i < 8; i++ {
+		logger.Info("repeated")
+	}
+	// lines 1, 2, 5 and 8 are written
+	if n := strings.Count(buf.String(), "repeated"); n != 4 {
+		t.Fatalf("expect 4 lines, got %d", n)
+	}
+}
+
+func TestFields(t *testing.T) {
+	logger := NewWithBackend(NewLogrus(Config{Output: &bytes.Buffer{}}))
+	logger.WithField("a", 1).WithField("b", 2).WithField("a", 3)
+	fields := logger.Fields()
+	if len(fields) != 2 || fields[0] != (Field{"a", 3}) || fields[1] != (Field{"b", 2}) {
+		t.Fatalf("unexpected fields %v", fields)
+	}
+}
+
+func TestLineVariants(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewWithBackend(NewLogrus(Config{Level: InfoLevel, Format: FormatJSON, Output: &buf}))
+	logger.Println("age", 3)
+	logger.Debugln("hidden")
+	logger.Logln(WarnLevel, "warn", "line")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"age 3"`) || !strings.Contains(lines[1], `"warn line"`) {
+		t.Fatalf("unexpected output %q", buf.String())
+	}
+}
+
+func TestNewWithContextFormatter(t *testing.T) {
+	var buf bytes.Buffer
+	logrus.SetOutput(&buf)
+	defer logrus.SetOutput(os.Stderr)
+
+	NewWithContext(context.Background(), &JSONFormatter{}).Info("std")
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil || line["msg"] != "std" {
+		t.Fatalf("expect json line, got %q", buf.String())
+	}
+
+	// backend attached to context wins over formatter
+	var own bytes.Buffer
+	ctx := WithBackend(context.Background(), NewLogrus(Config{Level: InfoLevel, Format: FormatText, Output: &own}))
+	NewWithContext(ctx, &JSONFormatter{}).Info("own")
+	if !strings.Contains(own.String(), `msg=own`) {
+		t.Fatalf("expect text line, got %q", own.String())
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, level := range []Level{PanicLevel, FatalLevel, ErrorLevel, WarnLevel, InfoLevel, DebugLevel, TraceLevel} {
+		parsed, err := ParseLevel(level.String())
+		if err != nil || parsed != level {
+			t.Fatalf("parse %s: %v %v", level, parsed, err)
+		}
+	}
+}
+
+func TestRuntimeLevel(t *testing.T) {
+	for _, name := range []string{"logrus", "zap", "slog"} {
+		b, err := NewBackend(Config{Backend: name, Level: InfoLevel, Output: &bytes.Buffer{}})
+		if name == "slog" && err != nil {
+			continue
+		}
+		if err := SetLevel(b, DebugLevel); err != nil {
+			t.Fatal(name, err)
+		}
+		if level, _ := GetLevel(b); level != DebugLevel || !b.Enabled(DebugLevel) {
+			t.Fatalf("%s: expect debug level, got %s", name, level)
+		}
+	}
+}
+
+func TestLevelOverride(t *testing.T) {
+	override, err := NewLevelOverride("", "10.0.0.0/8", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if level, ok := override.Level("127.0.0.1:5000", "debug"); !ok || level != DebugLevel {
+		t.Fatal("expect override from allowed ip")
+	}
+	if _, ok := override.Level("192.168.1.1", "debug"); ok {
+		t.Fatal("expect no override from not allowed ip")
+	}
+	if _, ok := override.Level("10.1.2.3", "verbose"); ok {
+		t.Fatal("expect no override with invalid level")
+	}
+
+	for _, name := range []string{"logrus", "zap", "slog"} {
+		var buf bytes.Buffer
+		b, err := NewBackend(Config{Backend: name, Level: InfoLevel, Output: &buf})
+		if name == "slog" && err != nil {
+			continue
+		}
+		NewWithBackend(b).SetLevel(DebugLevel).Debug("overridden")
+		NewWithBackend(b).Debug("dropped")
+		if !strings.Contains(buf.String(), "overridden") || strings.Contains(buf.String(), "dropped") {
+			t.Fatalf("%s: unexpected output %q", name, buf.String())
+		}
+	}
+}
+
+type credentials struct {
+	User   string `json:"user"`
+	Pin    string `json:"pin" log:"redact"`
+	Secret string
+	Note   string `json:"note,omitempty"`
+}
+
+func TestRedactStruct(t *testing.T) {
+	r, err := NewRedactor(RedactConfig{MaxSize: 80, DisableBody: []string{"/auth.Service/*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := r.String(map[string]interface{}{
+		"creds": &credentials{User: "denny", Pin: "1234", Secret: "s3cr3t"},
+		"token": "abc",
+	})
+	for _, leaked := range []string{"1234", "s3cr3t", "abc", "note"} {
+		if strings.Contains(out, leaked) {
+			t.Fatalf("%q leaked in %s", leaked, out)
+		}
+	}
+	if !strings.Contains(out, `"user":"denny"`) {
+		t.Fatalf("unexpected output %s", out)
+	}
+	if out := r.String(strings.Repeat("x", 100)); !strings.Contains(out, "truncated") {
+		t.Fatalf("expect truncated output, got %s", out)
+	}
+	if r.BodyEnabled("/auth.Service/Login") || !r.BodyEnabled("/hello.Service/SayHello") {
+		t.Fatal("unexpected body switch")
+	}
+}
+
+func TestRedactProtoOption(t *testing.T) {
+	sensitive := protowire.AppendTag(nil, SensitiveOption, protowire.VarintType)
+	sensitive = protowire.AppendVarint(sensitive, 1)
+	pinOpts := &descriptorpb.FieldOptions{}
+	pinOpts.ProtoReflect().SetUnknown(sensitive)
+
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("login.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Login"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: proto.String("user"), Number: proto.Int32(1), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+				{Name: proto.String("pin"), Number: proto.Int32(2), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(), Options: pinOpts},
+			},
+		}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := fd.Messages().ByName("Login")
+	msg := dynamicpb.NewMessage(md)
+	msg.Set(md.Fields().ByName("user"), protoreflect.ValueOfString("denny"))
+	msg.Set(md.Fields().ByName("pin"), protoreflect.ValueOfString("1234"))
+
+	out := DefaultRedactor().String(msg)
+	if out != `{"pin":"***","user":"denny"}` {
+		t.Fatalf("unexpected output %s", out)
+	}
+}
+
+func TestRedactFieldName(t *testing.T) {
+	r := DefaultRedactor()
+	for name, sensitive := range map[string]bool{
+		"password": true, "redisPassword": true, "user_passwd": true, "client_secret": true, "accessToken": true,
+		"token": true, "X-Api-Key": true, "apikey": true, "Authorization": true, "credentials": true,
+		"next_page_token": false, "token_count": false, "secret_santa_id": false, "author": false,
+	} {
+		if r.SensitiveName(name) != sensitive {
+			t.Errorf("%s: expect sensitive %v", name, sensitive)
+		}
+	}
+
+	// logger fields are only masked when enabled
+	logger := NewWithBackend(NewLogrus(Config{Output: &bytes.Buffer{}}))
+	logger.WithField("redisPassword", "secret")
+	if fields := logger.Fields(); fields[0].Value != "secret" {
+		t.Fatalf("expect field as is, got %v", fields[0].Value)
+	}
+	masking, err := NewRedactor(RedactConfig{MaskFields: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetRedactor(masking)
+	defer SetRedactor(r)
+	logger.WithField("redisPassword", "secret")
+	if fields := logger.Fields(); fields[0].Value != "***" {
+		t.Fatalf("expect masked field, got %v", fields[0].Value)
+	}
+}
+
+func TestTraceFields(t *testing.T) {
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  spanID,
+	}))
+	fields := NewWithContext(ctx).Fields()
+	if len(fields) != 2 || fields[0] != (Field{"trace_id", traceID.String()}) || fields[1] != (Field{"span_id", spanID.String()}) {
+		t.Fatalf("unexpected fields %v", fields)
+	}
+
+	tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(true), jaeger.NewNullReporter())
+	defer closer.Close()
+	span := tracer.StartSpan("test")
+	defer span.Finish()
+	SetTraceFields(TraceFields{TraceID: "dd.trace_id"})
+	defer SetTraceFields(TraceFields{TraceID: "trace_id", SpanID: "span_id"})
+	fields = NewWithContext(opentracing.ContextWithSpan(context.Background(), span)).Fields()
+	jaegerID := span.Context().(jaeger.SpanContext).TraceID().String()
+	if len(fields) != 1 || fields[0] != (Field{"dd.trace_id", jaegerID}) {
+		t.Fatalf("unexpected fields %v", fields)
+	}
+}
@@ -0,0 +1,85 @@
+package log
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+type TextFormatter = logrus.TextFormatter
+type JSONFormatter = logrus.JSONFormatter
+type Formatter = logrus.Formatter
+
+type logrusBackend struct {
+	logger *logrus.Logger
+}
+
+// NewLogrus creates logrus backend with given config
+func NewLogrus(cfg Config) Backend {
+	logger := logrus.New()
+	logger.SetOutput(cfg.output())
+	logger.SetLevel(logrus.Level(cfg.Level))
+	if cfg.Format == FormatJSON {
+		logger.SetFormatter(&logrus.JSONFormatter{})
+	}
+	return withSampling(NewLogrusFrom(logger), cfg.Sampling)
+}
+
+// NewLogrusFrom creates backend which writes to given logrus logger,
+// logrus standard logger is used when logger is nil
+func NewLogrusFrom(logger *logrus.Logger) Backend {
+	return &logrusBackend{logger: logger}
+}
+
+func (b *logrusBackend) std() *logrus.Logger {
+	if b.logger == nil {
+		return logrus.StandardLogger()
+	}
+	return b.logger
+}
+
+func (b *logrusBackend) Enabled(level Level) bool {
+	return b.std().IsLevelEnabled(logrus.Level(level))
+}
+
+func (b *logrusBackend) GetLevel() Level {
+	return Level(b.std().GetLevel())
+}
+
+func (b *logrusBackend) SetLevel(level Level) {
+	b.std().SetLevel(logrus.Level(level))
+}
+
+func (b *logrusBackend) Log(level Level, msg string, fields []Field) {
+	data := make(logrus.Fields, len(fields))
+	for _, f := range fields {
+		data[f.Key] = f.Value
+	}
+	logger := b.std()
+	if !logger.IsLevelEnabled(logrus.Level(level)) {
+		// level is overridden for this log, logrus drops entries below logger level
+		// so entry is written by a logger sharing output, formatter and hooks
+		forced := logrus.New()
+		forced.Out = logger.Out
+		forced.Formatter = logger.Formatter
+		forced.Hooks = logger.Hooks
+		forced.ReportCaller = logger.ReportCaller
+		forced.SetLevel(logrus.TraceLevel)
+		logger = forced
+	}
+	entry := logger.WithFields(data)
+	if level == PanicLevel {
+		// logrus panics after writing panic level entry, Log does it itself
+		defer func() {
+			_ = recover()
+		}()
+	}
+	entry.Log(logrus.Level(level), msg)
+}
+
+// newLogrusLogger returns logger which shares output and level with logrus standard logger
+func newLogrusLogger() *logrus.Logger {
+	std := logrus.StandardLogger()
+	logger := logrus.New()
+	logger.SetOutput(std.Out)
+	logger.SetLevel(std.GetLevel())
+	return logger
+}
@@ -0,0 +1,85 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// DefaultOverrideKey is http header / grpc metadata key which carries per request log level
+const DefaultOverrideKey = "X-Log-Level"
+
+// LevelOverride allows clients from listed networks to change log level of their own requests
+// by sending level name in a http header or grpc metadata, eg: X-Log-Level: debug
+type LevelOverride struct {
+	Key   string
+	allow []*net.IPNet
+}
+
+// NewLevelOverride creates override which reads level from given key (DefaultOverrideKey when empty),
+// only requests coming from allowed IPs or CIDRs are honored
+func NewLevelOverride(key string, allow ...string) (*LevelOverride, error) {
+	if key == "" {
+		key = DefaultOverrideKey
+	}
+	o := &LevelOverride{Key: key}
+	for _, a := range allow {
+		if !strings.Contains(a, "/") {
+			ip := net.ParseIP(a)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid ip: %q", a)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			o.allow = append(o.allow, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(a)
+		if err != nil {
+			return nil, err
+		}
+		o.allow = append(o.allow, network)
+	}
+	return o, nil
+}
+
+// Level returns level requested by client, ok is false when value is empty or invalid
+// or client is not allowed to override level
+func (o *LevelOverride) Level(clientIP string, value string) (level Level, ok bool) {
+	if o == nil || value == "" {
+		return InfoLevel, false
+	}
+	if host, _, err := net.SplitHostPort(clientIP); err == nil {
+		clientIP = host
+	}
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return InfoLevel, false
+	}
+	for _, network := range o.allow {
+		if network.Contains(ip) {
+			level, err := ParseLevel(value)
+			return level, err == nil
+		}
+	}
+	return InfoLevel, false
+}
+
+type overrideKey struct{}
+
+// WithLevelOverride returns context carrying given override, logging middleware honors it
+func WithLevelOverride(ctx context.Context, o *LevelOverride) context.Context {
+	return context.WithValue(ctx, overrideKey{}, o)
+}
+
+// LevelOverrideFromContext returns override attached to context or nil
+func LevelOverrideFromContext(ctx context.Context) *LevelOverride {
+	if ctx == nil {
+		return nil
+	}
+	o, _ := ctx.Value(overrideKey{}).(*LevelOverride)
+	return o
+}
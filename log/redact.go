@@ -0,0 +1,450 @@
+package log
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	protoV1 "github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const (
+	// RedactTag is struct tag which marks sensitive field: Password string `log:"redact"`
+	RedactTag = "log"
+	// SensitiveOption is field number of (denny.sensitive) proto field option, see options.proto
+	SensitiveOption = 50501
+	// debugRedactOption is field number of debug_redact in google.protobuf.FieldOptions
+	debugRedactOption = 16
+
+	defaultMask    = "***"
+	defaultMaxSize = 4096
+	maxDepth       = 32
+)
+
+// DefaultSensitiveNames are field name patterns masked by default redactor, they match whole snake_case names
+// so eg: access_token is masked while next_page_token and token_count are not
+var DefaultSensitiveNames = []string{
+	"(.+_)?passw(or)?d", "(.+_)?secret", "(access|refresh|id|auth|bearer|session|csrf)_token", "token",
+	"authorization", "(x_)?api_?key", "private_key", "credentials?",
+}
+
+// RedactConfig configures redaction of logged payloads, it can be read from config:
+// config.Scan(&cfg, "log", "redact")
+type RedactConfig struct {
+	// Names are case insensitive regular expressions of field names to mask, they must match whole name,
+	// camelCase and kebab-case names are also matched in snake_case (accessToken as access_token)
+	Names []string `json:"names"`
+	// Mask replaces sensitive values, default "***"
+	Mask string `json:"mask"`
+	// MaxSize truncates logged payloads longer than MaxSize bytes, default 4096, negative disables truncation
+	MaxSize int `json:"max_size"`
+	// ProtoOption is field number of bool proto field option marking sensitive fields,
+	// default SensitiveOption, debug_redact is always honored
+	ProtoOption int32 `json:"proto_option"`
+	// DisableBody lists grpc methods whose request/response bodies are not logged,
+	// patterns are matched with path.Match, eg: "/hello.HelloService/*"
+	DisableBody []string `json:"disable_body"`
+	// MaskFields masks values of logger fields (Log.WithField) with sensitive names too,
+	// by default only logged payloads are redacted
+	MaskFields bool `json:"mask_fields"`
+}
+
+// Redactor masks sensitive fields of payloads before they are logged
+type Redactor struct {
+	names       *regexp.Regexp
+	mask        string
+	maxSize     int
+	protoOption protowire.Number
+	disableBody []string
+	maskFields  bool
+	// sensitive caches result of proto field checks by field full name
+	sensitive sync.Map
+}
+
+// NewRedactor creates redactor with given config, DefaultSensitiveNames are used when cfg.Names is empty
+func NewRedactor(cfg RedactConfig) (*Redactor, error) {
+	names := cfg.Names
+	if len(names) == 0 {
+		names = DefaultSensitiveNames
+	}
+	re, err := regexp.Compile("(?i)^(?:" + strings.Join(names, "|") + ")$")
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range cfg.DisableBody {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid disable_body pattern %q: %v", p, err)
+		}
+	}
+	r := &Redactor{
+		names:       re,
+		mask:        cfg.Mask,
+		maxSize:     cfg.MaxSize,
+		protoOption: protowire.Number(cfg.ProtoOption),
+		disableBody: cfg.DisableBody,
+		maskFields:  cfg.MaskFields,
+	}
+	if r.mask == "" {
+		r.mask = defaultMask
+	}
+	if r.maxSize == 0 {
+		r.maxSize = defaultMaxSize
+	}
+	if r.protoOption == 0 {
+		r.protoOption = SensitiveOption
+	}
+	return r, nil
+}
+
+var (
+	redactorMu         sync.RWMutex
+	defaultRedactor, _ = NewRedactor(RedactConfig{})
+)
+
+// SetRedactor replaces redactor used by loggers and logging middleware
+func SetRedactor(r *Redactor) {
+	redactorMu.Lock()
+	defer redactorMu.Unlock()
+	defaultRedactor = r
+}
+
+// DefaultRedactor returns redactor used by loggers and logging middleware
+func DefaultRedactor() *Redactor {
+	redactorMu.RLock()
+	defer redactorMu.RUnlock()
+	return defaultRedactor
+}
+
+// SensitiveName reports whether field with given name must be masked
+func (r *Redactor) SensitiveName(name string) bool {
+	return r.names.MatchString(name) || r.names.MatchString(snakeCase(name))
+}
+
+// snakeCase converts camelCase, kebab-case and dotted names to snake_case
+func snakeCase(name string) string {
+	var b strings.Builder
+	for i, c := range name {
+		switch {
+		case c == '-' || c == '.' || c == ' ':
+			b.WriteByte('_')
+		case c >= 'A' && c <= 'Z':
+			if i > 0 {
+				if p := name[i-1]; p >= 'a' && p <= 'z' || p >= '0' && p <= '9' {
+					b.WriteByte('_')
+				}
+			}
+			b.WriteRune(c + 'a' - 'A')
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// MaskFields reports whether logger fields with sensitive names are masked, see RedactConfig.MaskFields
+func (r *Redactor) MaskFields() bool {
+	return r.maskFields
+}
+
+// Mask returns value which replaces sensitive values
+func (r *Redactor) Mask() string {
+	return r.mask
+}
+
+// BodyEnabled reports whether request/response bodies of given grpc method are logged
+func (r *Redactor) BodyEnabled(route string) bool {
+	for _, p := range r.disableBody {
+		if ok, _ := path.Match(p, route); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns json of redacted value, truncated to configured max size
+func (r *Redactor) String(v interface{}) string {
+	bytes, err := json.Marshal(r.Redact(v))
+	if err != nil {
+		return ""
+	}
+	if r.maxSize > 0 && len(bytes) > r.maxSize {
+		return fmt.Sprintf("%s...(truncated %d bytes)", bytes[:r.maxSize], len(bytes)-r.maxSize)
+	}
+	return string(bytes)
+}
+
+// URL returns url with values of sensitive query params masked
+func (r *Redactor) URL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	if u.RawQuery == "" {
+		return u.String()
+	}
+	query := u.Query()
+	for k := range query {
+		if r.SensitiveName(k) {
+			query[k] = []string{r.mask}
+		}
+	}
+	masked := *u
+	masked.RawQuery = query.Encode()
+	return masked.String()
+}
+
+// Redact returns copy of v suitable for json encoding where sensitive fields are masked.
+// fields are sensitive when their names match configured patterns, when they are tagged with
+// `log:"redact"` or when their proto field option (denny.sensitive) or debug_redact is set
+func (r *Redactor) Redact(v interface{}) interface{} {
+	return r.value(reflect.ValueOf(v), 0)
+}
+
+func (r *Redactor) value(v reflect.Value, depth int) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	if depth > maxDepth {
+		return fmt.Sprintf("%v", v.Type())
+	}
+	if v.CanInterface() {
+		if m, ok := protoMessage(v.Interface()); ok {
+			return r.message(m.ProtoReflect(), depth)
+		}
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return r.value(v.Elem(), depth+1)
+	case reflect.Struct:
+		if marshaler(v) {
+			return v.Interface()
+		}
+		fields := make(map[string]interface{}, v.NumField())
+		r.structFields(v, fields, depth)
+		return fields
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		fields := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key := fmt.Sprint(iter.Key().Interface())
+			if r.SensitiveName(key) {
+				fields[key] = r.mask
+				continue
+			}
+			fields[key] = r.value(iter.Value(), depth+1)
+		}
+		return fields
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && (v.IsNil() || v.Type().Elem().Kind() == reflect.Uint8) {
+			return v.Interface()
+		}
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = r.value(v.Index(i), depth+1)
+		}
+		return items
+	}
+	if v.CanInterface() {
+		return v.Interface()
+	}
+	return nil
+}
+
+func (r *Redactor) structFields(v reflect.Value, fields map[string]interface{}, depth int) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		name, omitEmpty, skip := jsonName(f)
+		if skip {
+			continue
+		}
+		fv := v.Field(i)
+		if f.Anonymous && name == "" {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				r.structFields(fv, fields, depth+1)
+				continue
+			}
+			if f.PkgPath != "" {
+				continue
+			}
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if omitEmpty && fv.IsZero() {
+			continue
+		}
+		if f.Tag.Get(RedactTag) == "redact" || r.SensitiveName(name) {
+			fields[name] = r.mask
+			continue
+		}
+		fields[name] = r.value(fv, depth+1)
+	}
+}
+
+func (r *Redactor) message(m protoreflect.Message, depth int) interface{} {
+	if !m.IsValid() {
+		return nil
+	}
+	fields := make(map[string]interface{})
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		name := string(fd.Name())
+		if r.sensitiveField(fd) {
+			fields[name] = r.mask
+			return true
+		}
+		switch {
+		case fd.IsList():
+			list := v.List()
+			items := make([]interface{}, list.Len())
+			for i := range items {
+				items[i] = r.protoValue(fd, list.Get(i), depth)
+			}
+			fields[name] = items
+		case fd.IsMap():
+			entries := make(map[string]interface{}, v.Map().Len())
+			v.Map().Range(func(k protoreflect.MapKey, mv protoreflect.Value) bool {
+				entries[k.String()] = r.protoValue(fd.MapValue(), mv, depth)
+				return true
+			})
+			fields[name] = entries
+		default:
+			fields[name] = r.protoValue(fd, v, depth)
+		}
+		return true
+	})
+	return fields
+}
+
+func (r *Redactor) protoValue(fd protoreflect.FieldDescriptor, v protoreflect.Value, depth int) interface{} {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		if depth > maxDepth {
+			return string(fd.Message().FullName())
+		}
+		return r.message(v.Message(), depth+1)
+	case protoreflect.EnumKind:
+		return int32(v.Enum())
+	}
+	return v.Interface()
+}
+
+func (r *Redactor) sensitiveField(fd protoreflect.FieldDescriptor) bool {
+	if r.SensitiveName(string(fd.Name())) {
+		return true
+	}
+	if v, ok := r.sensitive.Load(fd.FullName()); ok {
+		return v.(bool)
+	}
+	sensitive := false
+	if opts, ok := fd.Options().(*descriptorpb.FieldOptions); ok && opts != nil {
+		sensitive = boolOption(opts, debugRedactOption) || boolOption(opts, r.protoOption)
+	}
+	r.sensitive.Store(fd.FullName(), sensitive)
+	return sensitive
+}
+
+// boolOption reports whether bool option with given field number is set, option is either
+// a known extension or an unknown field when extension is not linked into binary
+func boolOption(opts proto.Message, number protowire.Number) bool {
+	found := false
+	m := opts.ProtoReflect()
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.Number() == number && fd.Kind() == protoreflect.BoolKind {
+			found = v.Bool()
+			return false
+		}
+		return true
+	})
+	if found {
+		return true
+	}
+	b := m.GetUnknown()
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return false
+		}
+		b = b[n:]
+		if num == number && typ == protowire.VarintType {
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return false
+			}
+			found = v != 0
+			b = b[n:]
+			continue
+		}
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return false
+		}
+		b = b[n:]
+	}
+	return found
+}
+
+func protoMessage(v interface{}) (proto.Message, bool) {
+	switch m := v.(type) {
+	case proto.Message:
+		return m, true
+	case protoV1.Message:
+		return protoV1.MessageV2(m), true
+	}
+	return nil, false
+}
+
+func marshaler(v reflect.Value) bool {
+	if !v.CanInterface() {
+		return false
+	}
+	switch v.Interface().(type) {
+	case json.Marshaler, encoding.TextMarshaler:
+		return true
+	}
+	if v.CanAddr() {
+		switch v.Addr().Interface().(type) {
+		case json.Marshaler, encoding.TextMarshaler:
+			return true
+		}
+	}
+	return false
+}
+
+func jsonName(f reflect.StructField) (name string, omitEmpty bool, skip bool) {
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false, true
+	}
+	parts := strings.Split(tag, ",")
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			omitEmpty = true
+		}
+	}
+	return parts[0], omitEmpty, false
+}
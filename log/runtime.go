@@ -0,0 +1,91 @@
+package log
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// ErrLevelNotSupported is returned when level of backend can not be changed at runtime
+var ErrLevelNotSupported = errors.New("log backend does not support changing level")
+
+// Leveler is implemented by backends whose level can be changed at runtime,
+// all built-in backends created from Config implement it
+type Leveler interface {
+	GetLevel() Level
+	SetLevel(level Level)
+}
+
+func leveler(b Backend) (Leveler, bool) {
+	if b == nil {
+		b = Default()
+	}
+	if s, ok := b.(*sampled); ok {
+		b = s.Backend
+	}
+	l, ok := b.(Leveler)
+	return l, ok
+}
+
+// SetLevel changes level of backend at runtime, default backend is used when b is nil
+func SetLevel(b Backend, level Level) error {
+	l, ok := leveler(b)
+	if !ok {
+		return ErrLevelNotSupported
+	}
+	l.SetLevel(level)
+	return nil
+}
+
+// GetLevel returns current level of backend, default backend is used when b is nil
+func GetLevel(b Backend) (Level, error) {
+	l, ok := leveler(b)
+	if !ok {
+		return InfoLevel, ErrLevelNotSupported
+	}
+	return l.GetLevel(), nil
+}
+
+// LevelHandler returns http handler which reports level of backend on GET
+// and changes it on PUT/POST, new level is read from "level" query/form param
+// or from json body: {"level": "debug"}
+func LevelHandler(b Backend) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			name := req.FormValue("level")
+			if name == "" {
+				var body struct {
+					Level string `json:"level"`
+				}
+				_ = json.NewDecoder(req.Body).Decode(&body)
+				name = body.Level
+			}
+			level, err := ParseLevel(name)
+			if err != nil {
+				writeLevel(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			if err := SetLevel(b, level); err != nil {
+				writeLevel(w, http.StatusNotImplemented, map[string]string{"error": err.Error()})
+				return
+			}
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		level, err := GetLevel(b)
+		if err != nil {
+			writeLevel(w, http.StatusNotImplemented, map[string]string{"error": err.Error()})
+			return
+		}
+		writeLevel(w, http.StatusOK, map[string]string{"level": level.String()})
+	})
+}
+
+func writeLevel(w http.ResponseWriter, code int, body map[string]string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,102 @@
+//go:build go1.21
+
+package log
+
+import (
+	"context"
+	"log/slog"
+)
+
+func init() {
+	RegisterBackend("slog", NewSlog)
+}
+
+// slog has no trace, fatal and panic levels, they are mapped around existing ones
+const (
+	slogTrace = slog.LevelDebug - 4
+	slogFatal = slog.LevelError + 4
+	slogPanic = slog.LevelError + 8
+)
+
+type slogBackend struct {
+	handler slog.Handler
+}
+
+// leveledSlog is slog backend created from Config, its level can be changed at runtime
+type leveledSlog struct {
+	*slogBackend
+	level *slog.LevelVar
+}
+
+// NewSlog creates log/slog backend with given config
+func NewSlog(cfg Config) Backend {
+	level := new(slog.LevelVar)
+	level.Set(slogLevel(cfg.Level))
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	if cfg.Format == FormatJSON {
+		handler = slog.NewJSONHandler(cfg.output(), opts)
+	} else {
+		handler = slog.NewTextHandler(cfg.output(), opts)
+	}
+	return withSampling(&leveledSlog{slogBackend: &slogBackend{handler: handler}, level: level}, cfg.Sampling)
+}
+
+// NewSlogFrom creates backend which writes to given slog handler
+func NewSlogFrom(handler slog.Handler) Backend {
+	return &slogBackend{handler: handler}
+}
+
+func slogLevel(level Level) slog.Level {
+	switch level {
+	case PanicLevel:
+		return slogPanic
+	case FatalLevel:
+		return slogFatal
+	case ErrorLevel:
+		return slog.LevelError
+	case WarnLevel:
+		return slog.LevelWarn
+	case InfoLevel:
+		return slog.LevelInfo
+	case DebugLevel:
+		return slog.LevelDebug
+	}
+	return slogTrace
+}
+
+func (b *leveledSlog) GetLevel() Level {
+	switch l := b.level.Level(); {
+	case l >= slogPanic:
+		return PanicLevel
+	case l >= slogFatal:
+		return FatalLevel
+	case l >= slog.LevelError:
+		return ErrorLevel
+	case l >= slog.LevelWarn:
+		return WarnLevel
+	case l >= slog.LevelInfo:
+		return InfoLevel
+	case l >= slog.LevelDebug:
+		return DebugLevel
+	}
+	return TraceLevel
+}
+
+func (b *leveledSlog) SetLevel(level Level) {
+	b.level.Set(slogLevel(level))
+}
+
+func (b *slogBackend) Enabled(level Level) bool {
+	return b.handler.Enabled(context.Background(), slogLevel(level))
+}
+
+// Log hands record to handler directly, built-in handlers do not check level in Handle
+// so lines of logs with overridden level are written
+func (b *slogBackend) Log(level Level, msg string, fields []Field) {
+	record := slog.NewRecord(now(), slogLevel(level), msg, 0)
+	for _, f := range fields {
+		record.AddAttrs(slog.Any(f.Key, f.Value))
+	}
+	_ = b.handler.Handle(context.Background(), record)
+}
@@ -0,0 +1,89 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/opentracing/opentracing-go"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceFields are names of fields which carry trace id and span id in log lines,
+// empty name disables the field
+type TraceFields struct {
+	TraceID string
+	SpanID  string
+}
+
+var (
+	traceFieldsMu sync.RWMutex
+	traceFields   = TraceFields{TraceID: "trace_id", SpanID: "span_id"}
+)
+
+// SetTraceFields changes names of trace fields to match log pipeline, eg: dd.trace_id
+func SetTraceFields(fields TraceFields) {
+	traceFieldsMu.Lock()
+	defer traceFieldsMu.Unlock()
+	traceFields = fields
+}
+
+func getTraceFields() TraceFields {
+	traceFieldsMu.RLock()
+	defer traceFieldsMu.RUnlock()
+	return traceFields
+}
+
+// TraceIDs returns trace id and span id of OpenTelemetry or opentracing span in context
+func TraceIDs(ctx context.Context) (traceID string, spanID string, ok bool) {
+	if ctx == nil {
+		return "", "", false
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		return sc.TraceID().String(), sc.SpanID().String(), true
+	}
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return "", "", false
+	}
+	// opentracing does not expose ids, tracers such as jaeger and zipkin
+	// have TraceID() and SpanID() methods on their span context
+	sc := reflect.ValueOf(span.Context())
+	traceID, spanID = callID(sc, "TraceID"), callID(sc, "SpanID")
+	return traceID, spanID, traceID != ""
+}
+
+func callID(v reflect.Value, name string) string {
+	if !v.IsValid() {
+		return ""
+	}
+	m := v.MethodByName(name)
+	if !m.IsValid() || m.Type().NumIn() != 0 || m.Type().NumOut() != 1 {
+		return ""
+	}
+	id := m.Call(nil)[0].Interface()
+	if s, ok := id.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprint(id)
+}
+
+// WithTrace adds trace id and span id of span in context to log,
+// it does nothing when context has no span
+func (l *Log) WithTrace(ctx context.Context) *Log {
+	traceID, spanID, ok := TraceIDs(ctx)
+	if !ok {
+		return l
+	}
+	fields := getTraceFields()
+	l.Lock()
+	defer l.Unlock()
+	if fields.TraceID != "" {
+		l.setField(fields.TraceID, traceID)
+	}
+	if fields.SpanID != "" && spanID != "" {
+		l.setField(fields.SpanID, spanID)
+	}
+	return l
+}
@@ -0,0 +1,103 @@
+package log
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type zapBackend struct {
+	core zapcore.Core
+}
+
+// leveledZap is zap backend created from Config, its level can be changed at runtime
+type leveledZap struct {
+	*zapBackend
+	level zap.AtomicLevel
+}
+
+// NewZap creates zap backend with given config
+func NewZap(cfg Config) Backend {
+	encoderCfg := zap.NewProductionEncoderConfig()
+	encoderCfg.EncodeTime = zapcore.ISO8601TimeEncoder
+	var encoder zapcore.Encoder
+	if cfg.Format == FormatText {
+		encoder = zapcore.NewConsoleEncoder(encoderCfg)
+	} else {
+		encoder = zapcore.NewJSONEncoder(encoderCfg)
+	}
+	level := zap.NewAtomicLevelAt(zapLevel(cfg.Level))
+	core := zapcore.NewCore(encoder, zapcore.AddSync(cfg.output()), level)
+	return withSampling(&leveledZap{zapBackend: &zapBackend{core: core}, level: level}, cfg.Sampling)
+}
+
+// NewZapFrom creates backend which writes to core of given zap logger
+func NewZapFrom(logger *zap.Logger) Backend {
+	return &zapBackend{core: logger.Core()}
+}
+
+func zapLevel(level Level) zapcore.Level {
+	switch level {
+	case PanicLevel:
+		return zapcore.PanicLevel
+	case FatalLevel:
+		return zapcore.FatalLevel
+	case ErrorLevel:
+		return zapcore.ErrorLevel
+	case WarnLevel:
+		return zapcore.WarnLevel
+	case InfoLevel:
+		return zapcore.InfoLevel
+	}
+	// zap has no trace level
+	return zapcore.DebugLevel
+}
+
+func fromZapLevel(level zapcore.Level) Level {
+	switch level {
+	case zapcore.PanicLevel, zapcore.DPanicLevel:
+		return PanicLevel
+	case zapcore.FatalLevel:
+		return FatalLevel
+	case zapcore.ErrorLevel:
+		return ErrorLevel
+	case zapcore.WarnLevel:
+		return WarnLevel
+	case zapcore.InfoLevel:
+		return InfoLevel
+	}
+	return DebugLevel
+}
+
+func (b *leveledZap) GetLevel() Level {
+	return fromZapLevel(b.level.Level())
+}
+
+func (b *leveledZap) SetLevel(level Level) {
+	b.level.SetLevel(zapLevel(level))
+}
+
+func (b *zapBackend) Enabled(level Level) bool {
+	return b.core.Enabled(zapLevel(level))
+}
+
+// Log writes entry to zap core directly, unlike zap.Logger, core does not
+// exit or panic at fatal/panic level
+func (b *zapBackend) Log(level Level, msg string, fields []Field) {
+	entry := zapcore.Entry{
+		Level:   zapLevel(level),
+		Time:    now(),
+		Message: msg,
+	}
+	zapFields := make([]zapcore.Field, 0, len(fields))
+	for _, f := range fields {
+		zapFields = append(zapFields, zap.Any(f.Key, f.Value))
+	}
+	if !b.core.Enabled(entry.Level) {
+		// level is overridden for this log, core.Write does not check level
+		_ = b.core.Write(entry, zapFields)
+		return
+	}
+	if ce := b.core.Check(entry, nil); ce != nil {
+		ce.Write(zapFields...)
+	}
+}
@@ -6,13 +6,10 @@ import (
 )
 
 func GetLogger(ctx context.Context) *log.Log {
-	var (
-		logger interface{}
-	)
 	if ctx, ok := ctx.(*Context); ok {
 		logger, ok := ctx.Get(log.LogKey)
 		if !ok {
-			logger := log.New()
+			logger := log.NewWithContext(ctx.Request.Context())
 			ctx.Set(log.LogKey, logger)
 			return logger
 		}
@@ -20,11 +17,7 @@ func GetLogger(ctx context.Context) *log.Log {
 	}
 	logger, ok := ctx.Value(log.LogKey).(*log.Log)
 	if !ok {
-		logger := log.New()
-		ctx = context.WithValue(
-			ctx,
-			log.LogKey, logger)
-		return logger
+		return log.NewWithContext(ctx)
 	}
-	return logger.(*log.Log)
+	return logger
 }
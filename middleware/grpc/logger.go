@@ -7,13 +7,16 @@ import (
 	"github.com/whatvn/denny/log"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 )
 
 func LoggerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
 	var (
-		logger    = log.New(&log.JSONFormatter{})
+		logger    = log.NewWithContext(ctx, &log.JSONFormatter{})
+		redactor  = log.DefaultRedactor()
+		logBody   = redactor.BodyEnabled(info.FullMethod)
 		start     = time.Now()
 		panicking = true
 	)
@@ -21,12 +24,23 @@ func LoggerInterceptor(ctx context.Context, req interface{}, info *grpc.UnarySer
 	p, ok := peer.FromContext(ctx)
 	if ok {
 		logger.WithField("request_ip", p.Addr.String())
+		if override := log.LevelOverrideFromContext(ctx); override != nil {
+			if md, ok := metadata.FromIncomingContext(ctx); ok {
+				if values := md.Get(override.Key); len(values) > 0 {
+					if level, ok := override.Level(p.Addr.String(), values[0]); ok {
+						logger.SetLevel(level)
+					}
+				}
+			}
+		}
 	}
 	logger.WithFields(map[string]interface{}{
-		"start":   start,
-		"uri":     info.FullMethod,
-		"request": logger.ToJsonString(req),
+		"start": start,
+		"uri":   info.FullMethod,
 	})
+	if logBody {
+		logger.WithField("request", redactor.String(req))
+	}
 
 	defer func() {
 		var (
@@ -48,6 +62,8 @@ func LoggerInterceptor(ctx context.Context, req interface{}, info *grpc.UnarySer
 	ctx = context.WithValue(ctx, log.LogKey, logger)
 	resp, err = handler(ctx, req)
 	panicking = false // normal exit, no panic happened, disarms defer
-	logger.WithField("response", resp)
+	if logBody {
+		logger.WithField("response", redactor.String(resp))
+	}
 	return
 }
@@ -0,0 +1,89 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/whatvn/denny/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// metadataCarrier adapts grpc metadata to OpenTelemetry propagation
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if values := metadata.MD(c).Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key string, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// RPCAttributes returns semantic convention attributes of grpc method: /package.Service/Method
+func RPCAttributes(fullMethod string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{semconv.RPCSystemGRPC}
+	name := strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		attrs = append(attrs, semconv.RPCServiceKey.String(name[:i]), semconv.RPCMethodKey.String(name[i+1:]))
+	}
+	return attrs
+}
+
+// TracingInterceptor starts an OpenTelemetry server span for every grpc call,
+// span context is extracted from W3C traceparent/baggage metadata, telemetry of Denny instance
+// (see Denny.WithTelemetry) or global OpenTelemetry providers are used
+func TracingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	var (
+		t     = tracing.FromContextOrDefault(ctx)
+		attrs = RPCAttributes(info.FullMethod)
+		start = time.Now()
+	)
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		ctx = t.TextMapPropagator().Extract(ctx, metadataCarrier(md))
+	}
+	spanAttrs := attrs
+	if p, ok := peer.FromContext(ctx); ok {
+		if host, port, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			spanAttrs = append(spanAttrs, semconv.NetPeerIPKey.String(host))
+			if port, err := strconv.Atoi(port); err == nil {
+				spanAttrs = append(spanAttrs, semconv.NetPeerPortKey.Int(port))
+			}
+		}
+	}
+	ctx, span := t.Tracer().Start(ctx, strings.TrimPrefix(info.FullMethod, "/"),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(spanAttrs...),
+	)
+	defer func() {
+		code := status.Code(err)
+		span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(code)))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+		t.RecordRPC(ctx, time.Since(start), append(attrs, semconv.RPCGRPCStatusCodeKey.Int(int(code)))...)
+	}()
+	return handler(ctx, req)
+}
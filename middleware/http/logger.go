@@ -10,7 +10,8 @@ import (
 
 func Logger() denny.HandleFunc {
 	return func(ctx *denny.Context) {
-		logger := log.New(&log.JSONFormatter{})
+		// lines are written as json unless Denny or log.SetDefault configures a backend
+		logger := log.NewWithContext(ctx.Request.Context(), &log.JSONFormatter{})
 		var (
 			clientIP = ctx.ClientIP()
 			method   = ctx.Request.Method
@@ -26,11 +27,20 @@ func Logger() denny.HandleFunc {
 			"client_ip":      clientIP,
 			"request_method": method,
 			"user_agent":     userAgent,
-			"uri":            uri,
+			"uri":            log.DefaultRedactor().URL(uri),
 		})
-		ctx.Request = ctx.Request.WithContext(context.WithValue(ctx, log.LogKey, logger))
+		override := log.LevelOverrideFromContext(ctx.Request.Context())
+		if override != nil {
+			// forwarded headers can be spoofed, only peer address of connection is trusted
+			if level, ok := override.Level(ctx.Request.RemoteAddr, ctx.GetHeader(override.Key)); ok {
+				logger.SetLevel(level)
+			}
+		}
+		ctx.Request = ctx.Request.WithContext(context.WithValue(ctx.Request.Context(), log.LogKey, logger))
 		ctx.Set(log.LogKey, logger)
 		ctx.Next()
+		// tracing middleware registered after logger starts span in downstream request context
+		logger.WithTrace(ctx.Request.Context())
 		var (
 			statusCode = ctx.Writer.Status()
 		)
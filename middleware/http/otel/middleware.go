@@ -0,0 +1,52 @@
+// Package otel provides OpenTelemetry http middleware, it is the OpenTelemetry counterpart of package ot
+package otel
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/whatvn/denny/tracing"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestTracer starts a server span for every http request, span context is extracted from
+// W3C traceparent/baggage headers, telemetry of Denny instance (see Denny.WithTelemetry)
+// or global OpenTelemetry providers are used
+func RequestTracer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var (
+			t     = tracing.FromContextOrDefault(c.Request.Context())
+			ctx   = t.TextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+			route = c.FullPath()
+			start = time.Now()
+		)
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+		ctx, span := t.Tracer().Start(ctx, route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest("", route, c.Request)...),
+			trace.WithAttributes(semconv.NetAttributesFromHTTPRequest("tcp", c.Request)...),
+		)
+		defer span.End()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(status)...)
+		code, msg := semconv.SpanStatusFromHTTPStatusCodeAndSpanKind(status, trace.SpanKindServer)
+		if err := c.Errors.Last(); err != nil {
+			span.RecordError(err.Err)
+			code, msg = codes.Error, err.Error()
+		}
+		span.SetStatus(code, msg)
+
+		attrs := append(semconv.HTTPServerMetricAttributesFromHTTPRequest("", c.Request),
+			semconv.HTTPRouteKey.String(route), semconv.HTTPStatusCodeKey.Int(status))
+		t.RecordHTTP(ctx, time.Since(start), attrs...)
+	}
+}
@@ -0,0 +1,421 @@
+// Package respcache provides http middleware which caches responses of GET routes and of idempotent
+// brpc controller methods in cache.Cache, it emits ETag/Last-Modified and answers conditional requests with 304
+package respcache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/whatvn/denny/cache"
+)
+
+const (
+	defaultPrefix       = "denny:http:"
+	defaultMaxBodyBytes = 1 << 20
+)
+
+// errBodyTooLarge is returned by key when request body exceeds MaxBodyBytes, request is then not cached
+var errBodyTooLarge = errors.New("respcache: request body is too large")
+
+// Rule configures caching of a route
+type Rule struct {
+	// TTL of cached response, response is not cached when it's 0 unless handler sets Cache-Control max-age
+	TTL time.Duration
+	// Headers are request headers which are part of cache key, eg: Accept-Language,
+	// they are listed in Vary header of response so downstream caches key by them too
+	Headers []string
+	// Methods are http methods which are cached, default is GET and HEAD. brpc methods which take
+	// input are served with POST, include it for idempotent ones, request body then becomes part of cache key
+	Methods []string
+	// Credentials caches requests carrying Authorization or Cookie header, they are not cached by default
+	// as their responses usually belong to one user, list those headers in Headers to cache per user
+	Credentials bool
+}
+
+// Config configures response cache
+type Config struct {
+	Cache cache.Cache
+	// Default is rule of routes without their own rule
+	Default Rule
+	// Routes maps route (eg: /v1/users/:id or /v1/hello/say-hello) to its rule
+	Routes map[string]Rule
+	// Prefix of cache keys, default is "denny:http:"
+	Prefix string
+	// MaxBodyBytes limits request body read to build cache key, requests with larger body are served
+	// without cache, default is 1MB
+	MaxBodyBytes int64
+}
+
+// entry is cached response
+type entry struct {
+	Status       int         `json:"status"`
+	Header       http.Header `json:"header"`
+	Body         []byte      `json:"body"`
+	ETag         string      `json:"etag"`
+	LastModified time.Time   `json:"last_modified"`
+}
+
+// ResponseCache caches http responses
+type ResponseCache struct {
+	cache   cache.Cache
+	dflt    Rule
+	routes  map[string]Rule
+	prefix  string
+	maxBody int64
+}
+
+// New creates response cache, it panics when cache is not given
+func New(cfg Config) *ResponseCache {
+	if cfg.Cache == nil {
+		panic("respcache: cache is not initialised")
+	}
+	m := &ResponseCache{
+		cache:   cfg.Cache,
+		dflt:    cfg.Default,
+		routes:  cfg.Routes,
+		prefix:  cfg.Prefix,
+		maxBody: cfg.MaxBodyBytes,
+	}
+	if len(m.prefix) == 0 {
+		m.prefix = defaultPrefix
+	}
+	if m.maxBody <= 0 {
+		m.maxBody = defaultMaxBodyBytes
+	}
+	return m
+}
+
+func (m *ResponseCache) rule(route string) Rule {
+	if r, ok := m.routes[route]; ok {
+		return r
+	}
+	return m.dflt
+}
+
+func (r Rule) allows(method string) bool {
+	if len(r.Methods) == 0 {
+		return method == http.MethodGet || method == http.MethodHead
+	}
+	for _, m := range r.Methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handler returns middleware which serves cached responses and caches successful responses
+func (m *ResponseCache) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := routeOf(c)
+		rule := m.rule(route)
+		requestCC := parseCacheControl(c.GetHeader("Cache-Control"))
+		if !rule.allows(c.Request.Method) || requestCC.has("no-store") || (!rule.Credentials && hasCredentials(c.Request)) {
+			c.Next()
+			return
+		}
+		key, err := m.key(c, route, rule)
+		if err != nil {
+			if err != errBodyTooLarge {
+				_ = c.Error(err)
+			}
+			c.Next()
+			return
+		}
+		if !requestCC.has("no-cache") {
+			if e, ok := m.load(key); ok {
+				c.Header("Age", strconv.Itoa(int(time.Since(e.LastModified).Seconds())))
+				serve(c, e)
+				c.Abort()
+				return
+			}
+		}
+
+		w := &bufferedWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		if w.flushed || c.Writer.Written() {
+			// handler streamed response or sent its header itself, rest of body is written as is
+			_, _ = c.Writer.Write(w.body.Bytes())
+			return
+		}
+		addVary(c.Writer.Header(), rule.Headers)
+		e := &entry{
+			Status:       c.Writer.Status(),
+			Header:       storedHeader(c.Writer.Header()),
+			Body:         w.body.Bytes(),
+			LastModified: time.Now().UTC().Truncate(time.Second),
+		}
+		e.ETag = etag(e.Body)
+		ttl := rule.TTL
+		responseCC := parseCacheControl(c.Writer.Header().Get("Cache-Control"))
+		if age, ok := responseCC.maxAge(); ok {
+			ttl = age
+		}
+		if e.Status != http.StatusOK {
+			c.Status(e.Status)
+			_, _ = c.Writer.Write(e.Body)
+			return
+		}
+		if ttl > 0 && !responseCC.has("no-store") && !responseCC.has("private") {
+			if len(c.Writer.Header().Get("Cache-Control")) == 0 {
+				c.Header("Cache-Control", "max-age="+strconv.Itoa(int(ttl.Seconds())))
+				e.Header.Set("Cache-Control", c.Writer.Header().Get("Cache-Control"))
+			}
+			m.store(c.Request.Context(), key, e, ttl)
+		}
+		serve(c, e)
+	}
+}
+
+// InvalidateRoute removes cached responses of route, route is registered path, eg: /v1/users/:id
+func (m *ResponseCache) InvalidateRoute(route string) {
+	m.cache.Set(m.generationKey(route), newGeneration(), 0)
+}
+
+func (m *ResponseCache) generationKey(route string) string {
+	return m.prefix + "gen:" + route
+}
+
+// generation is part of cache keys of route, InvalidateRoute replaces it so responses cached before
+// are no longer found. When it's evicted from cache a new one is started, responses cached with
+// evicted generation can not be served again
+func (m *ResponseCache) generation(route string) string {
+	if v, ok := m.cache.Get(m.generationKey(route)).(string); ok && len(v) > 0 {
+		return v
+	}
+	gen := newGeneration()
+	m.cache.Set(m.generationKey(route), gen, 0)
+	return gen
+}
+
+// newGeneration returns generation based on current time so it never repeats an earlier one
+func newGeneration() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+// key is built from route, method, query, selected headers and, for methods other than GET/HEAD, request body
+func (m *ResponseCache) key(c *gin.Context, route string, rule Rule) (string, error) {
+	h := sha256.New()
+	h.Write([]byte(c.Request.Method + "\n" + c.Request.URL.Path + "\n" + c.Request.URL.Query().Encode() + "\n"))
+	headers := append([]string(nil), rule.Headers...)
+	sort.Strings(headers)
+	for _, name := range headers {
+		h.Write([]byte(http.CanonicalHeaderKey(name) + ":" + strings.Join(c.Request.Header[http.CanonicalHeaderKey(name)], ",") + "\n"))
+	}
+	if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead && c.Request.Body != nil {
+		body, err := ioutil.ReadAll(io.LimitReader(c.Request.Body, m.maxBody+1))
+		if err != nil {
+			return "", err
+		}
+		if int64(len(body)) > m.maxBody {
+			// handler still reads whole body
+			c.Request.Body = readCloser{io.MultiReader(bytes.NewReader(body), c.Request.Body), c.Request.Body}
+			return "", errBodyTooLarge
+		}
+		c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+		h.Write(body)
+	}
+	return m.prefix + route + ":" + m.generation(route) + ":" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (m *ResponseCache) load(key string) (*entry, bool) {
+	var data []byte
+	switch v := m.cache.Get(key).(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return nil, false
+	}
+	e := &entry{}
+	if err := json.Unmarshal(data, e); err != nil {
+		return nil, false
+	}
+	return e, true
+}
+
+func (m *ResponseCache) store(ctx context.Context, key string, e *entry, ttl time.Duration) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	if cc, ok := m.cache.(cache.ContextCache); ok {
+		_ = cc.SetContext(ctx, key, data, ttl)
+		return
+	}
+	m.cache.Set(key, data, int64((ttl+time.Second-1)/time.Second))
+}
+
+// serve writes cached response, or 304 when conditional request matches it
+func serve(c *gin.Context, e *entry) {
+	header := c.Writer.Header()
+	for k, v := range e.Header {
+		header[k] = v
+	}
+	header.Set("ETag", e.ETag)
+	header.Set("Last-Modified", e.LastModified.Format(http.TimeFormat))
+	if notModified(c.Request, e) {
+		c.Status(http.StatusNotModified)
+		c.Writer.WriteHeaderNow()
+		return
+	}
+	c.Status(e.Status)
+	if c.Request.Method == http.MethodHead {
+		c.Writer.WriteHeaderNow()
+		return
+	}
+	_, _ = c.Writer.Write(e.Body)
+}
+
+func notModified(req *http.Request, e *entry) bool {
+	if inm := req.Header.Get("If-None-Match"); len(inm) > 0 {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == e.ETag {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := req.Header.Get("If-Modified-Since"); len(ims) > 0 {
+		t, err := http.ParseTime(ims)
+		return err == nil && !e.LastModified.After(t)
+	}
+	return false
+}
+
+func etag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// storedHeader copies response header except per response ones
+func storedHeader(h http.Header) http.Header {
+	stored := make(http.Header, len(h))
+	for k, v := range h {
+		stored[k] = append([]string(nil), v...)
+	}
+	for _, name := range []string{"Set-Cookie", "Date", "Content-Length", "Age"} {
+		stored.Del(name)
+	}
+	return stored
+}
+
+// addVary lists headers in Vary header, headers already listed are skipped
+func addVary(h http.Header, headers []string) {
+	vary := append([]string(nil), h["Vary"]...)
+	for _, name := range headers {
+		name = http.CanonicalHeaderKey(name)
+		listed := false
+		for _, v := range vary {
+			for _, n := range strings.Split(v, ",") {
+				if n = strings.TrimSpace(n); n == "*" || strings.EqualFold(n, name) {
+					listed = true
+				}
+			}
+		}
+		if !listed {
+			h.Add("Vary", name)
+			vary = append(vary, name)
+		}
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func hasCredentials(req *http.Request) bool {
+	return len(req.Header.Get("Authorization")) > 0 || len(req.Header.Get("Cookie")) > 0
+}
+
+func routeOf(c *gin.Context) string {
+	if route := c.FullPath(); len(route) > 0 {
+		return route
+	}
+	return c.Request.URL.Path
+}
+
+// bufferedWriter holds response body so it can be cached and served with ETag
+type bufferedWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+	// flushed is set when handler flushes response, body is then written through and not cached
+	flushed bool
+}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	if w.flushed {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.body.Write(data)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	if w.flushed {
+		return w.ResponseWriter.WriteString(s)
+	}
+	return w.body.WriteString(s)
+}
+
+// Flush writes buffered body and switches writer to write through
+func (w *bufferedWriter) Flush() {
+	if !w.flushed {
+		w.flushed = true
+		_, _ = w.ResponseWriter.Write(w.body.Bytes())
+		w.body.Reset()
+	}
+	w.ResponseWriter.Flush()
+}
+
+type cacheControl map[string]string
+
+func parseCacheControl(value string) cacheControl {
+	cc := cacheControl{}
+	for _, directive := range strings.Split(value, ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		if len(directive) == 0 {
+			continue
+		}
+		name, arg := directive, ""
+		if i := strings.Index(directive, "="); i >= 0 {
+			name, arg = directive[:i], strings.Trim(directive[i+1:], `"`)
+		}
+		cc[name] = arg
+	}
+	return cc
+}
+
+func (cc cacheControl) has(name string) bool {
+	_, ok := cc[name]
+	return ok
+}
+
+// maxAge returns s-maxage or max-age directive
+func (cc cacheControl) maxAge() (time.Duration, bool) {
+	for _, name := range []string{"s-maxage", "max-age"} {
+		if v, ok := cc[name]; ok {
+			if seconds, err := strconv.Atoi(v); err == nil {
+				return time.Duration(seconds) * time.Second, true
+			}
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,137 @@
+package respcache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/whatvn/denny/cache"
+)
+
+func TestResponseCache(t *testing.T) {
+	var (
+		calls int
+		rc    = New(Config{
+			Cache: cache.NewMemoryCache(cache.Config{GcDuration: 60}),
+			Routes: map[string]Rule{
+				"/users/:id": {TTL: time.Minute, Headers: []string{"Accept-Language"}},
+				"/say-hello": {TTL: time.Minute, Methods: []string{http.MethodPost}},
+			},
+		})
+		engine = gin.New()
+	)
+	engine.Use(rc.Handler())
+	handler := func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusOK, gin.H{"calls": calls})
+	}
+	engine.GET("/users/:id", handler)
+	engine.POST("/say-hello", handler)
+	engine.GET("/uncached", handler)
+	engine.GET("/private", func(c *gin.Context) {
+		calls++
+		c.Header("Cache-Control", "private, max-age=60")
+		c.String(http.StatusOK, "private")
+	})
+	engine.GET("/stream", func(c *gin.Context) {
+		calls++
+		c.String(http.StatusOK, "part1,")
+		c.Writer.Flush()
+		c.String(http.StatusOK, "part2")
+	})
+
+	do := func(method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+		var req *http.Request
+		if len(body) > 0 {
+			req = httptest.NewRequest(method, path, strings.NewReader(body))
+		} else {
+			req = httptest.NewRequest(method, path, nil)
+		}
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w
+	}
+
+	first := do(http.MethodGet, "/users/1", "", nil)
+	second := do(http.MethodGet, "/users/1", "", nil)
+	if calls != 1 || first.Body.String() != second.Body.String() {
+		t.Fatalf("response is not cached, calls: %d", calls)
+	}
+	etag := first.Header().Get("ETag")
+	if len(etag) == 0 || second.Header().Get("ETag") != etag {
+		t.Errorf("wrong etag %q", etag)
+	}
+	if w := do(http.MethodGet, "/users/1", "", map[string]string{"If-None-Match": etag}); w.Code != http.StatusNotModified || w.Body.Len() > 0 {
+		t.Errorf("expect 304, got %d", w.Code)
+	}
+	if first.Header().Get("Vary") != "Accept-Language" || second.Header().Get("Vary") != "Accept-Language" {
+		t.Errorf("keyed headers are not listed in Vary: %q, %q", first.Header().Get("Vary"), second.Header().Get("Vary"))
+	}
+	// selected header and request cache control are honored
+	do(http.MethodGet, "/users/1", "", map[string]string{"Accept-Language": "vi"})
+	do(http.MethodGet, "/users/1", "", map[string]string{"Cache-Control": "no-cache"})
+	if calls != 3 {
+		t.Errorf("expect 3 calls, got %d", calls)
+	}
+
+	rc.InvalidateRoute("/users/:id")
+	do(http.MethodGet, "/users/1", "", nil)
+	if calls != 4 {
+		t.Errorf("route is not invalidated, calls: %d", calls)
+	}
+	// evicted generation does not bring back responses cached with it
+	rc.cache.Delete(rc.generationKey("/users/:id"))
+	do(http.MethodGet, "/users/1", "", nil)
+	if calls != 5 {
+		t.Errorf("response of evicted generation is served, calls: %d", calls)
+	}
+
+	// brpc style post is keyed by body
+	do(http.MethodPost, "/say-hello", `{"greeting":"hi"}`, nil)
+	do(http.MethodPost, "/say-hello", `{"greeting":"hi"}`, nil)
+	do(http.MethodPost, "/say-hello", `{"greeting":"hello"}`, nil)
+	if calls != 7 {
+		t.Errorf("expect 7 calls, got %d", calls)
+	}
+	// body larger than limit is passed to handler as is and not cached
+	rc.maxBody = 8
+	large := `{"greeting":"hello world"}`
+	for i := 0; i < 2; i++ {
+		if w := do(http.MethodPost, "/say-hello", large, nil); w.Code != http.StatusOK {
+			t.Errorf("expect 200, got %d", w.Code)
+		}
+	}
+	if calls != 9 {
+		t.Errorf("large request is cached, calls: %d", calls)
+	}
+
+	do(http.MethodGet, "/uncached", "", nil)
+	do(http.MethodGet, "/uncached", "", nil)
+	if calls != 11 {
+		t.Errorf("route without rule is cached, calls: %d", calls)
+	}
+
+	// requests with credentials, private and streamed responses are not cached
+	rc.dflt = Rule{TTL: time.Minute}
+	do(http.MethodGet, "/users/2", "", map[string]string{"Authorization": "Bearer a"})
+	do(http.MethodGet, "/users/2", "", map[string]string{"Cookie": "session=b"})
+	do(http.MethodGet, "/private", "", nil)
+	do(http.MethodGet, "/private", "", nil)
+	if calls != 15 {
+		t.Errorf("expect 15 calls, got %d", calls)
+	}
+	for i := 0; i < 2; i++ {
+		if w := do(http.MethodGet, "/stream", "", nil); w.Body.String() != "part1,part2" {
+			t.Errorf("wrong streamed body %q", w.Body.String())
+		}
+	}
+	if calls != 17 {
+		t.Errorf("streamed response is cached, calls: %d", calls)
+	}
+}
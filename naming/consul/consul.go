@@ -0,0 +1,96 @@
+package consul
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/whatvn/denny/log"
+	"github.com/whatvn/denny/naming"
+	"google.golang.org/grpc/resolver"
+)
+
+type consul struct {
+	*log.Log
+	address     string
+	serviceName string
+	opts        *options
+	cc          resolver.ClientConn
+	probe       naming.HealthProbe
+	// stop channels of heartbeat goroutines, keyed by consul service id
+	sync.Mutex
+	shutdown map[string]chan struct{}
+	// resolver state
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+}
+
+// New consul
+// implement github.com/whatvn/denny/naming#Registry
+// consulAddr is consul agent http address, eg: 127.0.0.1:8500 or http://127.0.0.1:8500
+func New(consulAddr, serviceName string, opts ...Option) naming.Registry {
+	if len(serviceName) == 0 {
+		panic(errors.New("invalid service name"))
+	}
+	if !strings.HasPrefix(consulAddr, "http://") && !strings.HasPrefix(consulAddr, "https://") {
+		consulAddr = "http://" + consulAddr
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	registry := &consul{
+		Log:         log.New(),
+		address:     strings.TrimSuffix(consulAddr, "/"),
+		serviceName: serviceName,
+		opts:        newOptions(opts...),
+		shutdown:    make(map[string]chan struct{}),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+	registry.WithField("consul", consulAddr)
+	return registry
+}
+
+// NewResolver is alias to New(), and also register resolver automatically
+// so client does not have to call register resolver everytime
+func NewResolver(consulAddr, serviceName string, opts ...Option) naming.Registry {
+	registry := New(consulAddr, serviceName, opts...)
+	resolver.Register(registry)
+	return registry
+}
+
+// do sends request to consul agent and returns response if status code is 200
+// caller has to close response body
+func (r *consul) do(ctx context.Context, method, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, r.address+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if len(r.opts.token) > 0 {
+		req.Header.Set("X-Consul-Token", r.opts.token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := r.opts.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("consul: %s %s: %d %s", method, path, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+var (
+	_ naming.Registry        = new(consul)
+	_ naming.ServiceRegistry = new(consul)
+	_ naming.HealthReporter  = new(consul)
+)
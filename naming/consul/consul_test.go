@@ -0,0 +1,196 @@
+package consul
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/whatvn/denny/naming"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+type clientConn struct {
+	states chan resolver.State
+}
+
+func (c *clientConn) UpdateState(s resolver.State)  { c.states <- s }
+func (c *clientConn) ReportError(error)             {}
+func (c *clientConn) NewAddress([]resolver.Address) {}
+func (c *clientConn) NewServiceConfig(string)       {}
+func (c *clientConn) ParseServiceConfig(string) *serviceconfig.ParseResult {
+	return nil
+}
+
+// fakeAgent implements subset of consul agent http api
+type fakeAgent struct {
+	sync.Mutex
+	index    uint64
+	services map[string]agentService
+	passed   map[string]int
+	critical map[string]bool
+	changed  chan struct{}
+}
+
+func newFakeAgent() *fakeAgent {
+	return &fakeAgent{
+		index:    1,
+		services: make(map[string]agentService),
+		passed:   make(map[string]int),
+		critical: make(map[string]bool),
+		changed:  make(chan struct{}),
+	}
+}
+
+func (a *fakeAgent) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	a.Lock()
+	defer a.Unlock()
+	switch {
+	case req.URL.Path == "/v1/agent/service/register":
+		var svc agentService
+		_ = json.NewDecoder(req.Body).Decode(&svc)
+		a.services[svc.ID] = svc
+		a.bump()
+	case strings.HasPrefix(req.URL.Path, "/v1/agent/service/deregister/"):
+		delete(a.services, strings.TrimPrefix(req.URL.Path, "/v1/agent/service/deregister/"))
+		a.bump()
+	case strings.HasPrefix(req.URL.Path, "/v1/agent/check/pass/"):
+		id := strings.TrimPrefix(req.URL.Path, "/v1/agent/check/pass/")
+		a.passed[id]++
+		if a.critical[id] {
+			a.critical[id] = false
+			a.bump()
+		}
+	case strings.HasPrefix(req.URL.Path, "/v1/agent/check/fail/"):
+		id := strings.TrimPrefix(req.URL.Path, "/v1/agent/check/fail/")
+		if !a.critical[id] {
+			a.critical[id] = true
+			a.bump()
+		}
+	case strings.HasPrefix(req.URL.Path, "/v1/health/service/"):
+		if index := req.URL.Query().Get("index"); index == strconv.FormatUint(a.index, 10) {
+			changed := a.changed
+			a.Unlock()
+			select {
+			case <-changed:
+			case <-time.After(time.Second):
+			}
+			a.Lock()
+		}
+		var entries []serviceEntry
+		for _, svc := range a.services {
+			if a.critical[svc.Check.CheckID] {
+				continue
+			}
+			var e serviceEntry
+			e.Service.Address, e.Service.Port = svc.Address, svc.Port
+			entries = append(entries, e)
+		}
+		w.Header().Set("X-Consul-Index", strconv.FormatUint(a.index, 10))
+		_ = json.NewEncoder(w).Encode(entries)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (a *fakeAgent) bump() {
+	a.index++
+	close(a.changed)
+	a.changed = make(chan struct{})
+}
+
+func waitState(t *testing.T, cc *clientConn, n int) resolver.State {
+	for {
+		select {
+		case s := <-cc.states:
+			if len(s.Addresses) == n {
+				return s
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("expect %d addresses", n)
+		}
+	}
+}
+
+func TestConsulRegistry(t *testing.T) {
+	var (
+		agent  = newFakeAgent()
+		server = httptest.NewServer(agent)
+		cc     = &clientConn{states: make(chan resolver.State, 10)}
+	)
+	defer server.Close()
+
+	registry := New(server.URL, "demo.svc", WithWaitTime(time.Second))
+	r, err := registry.Build(resolver.Target{Scheme: registry.Scheme(), Endpoint: "demo.svc"}, cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if err := registry.Register("10.0.0.1:8080", 1); err != nil {
+		t.Fatal(err)
+	}
+	state := waitState(t, cc, 1)
+	if state.Addresses[0].Addr != "10.0.0.1:8080" {
+		t.Errorf("unexpected address %s", state.Addresses[0].Addr)
+	}
+
+	agent.Lock()
+	svc := agent.services["demo.svc-10.0.0.1:8080"]
+	passed := agent.passed["service:demo.svc-10.0.0.1:8080"]
+	agent.Unlock()
+	if svc.Check == nil || svc.Check.TTL != "2s" {
+		t.Error("expect ttl check to be registered")
+	}
+	if passed == 0 {
+		t.Error("expect ttl check to be passed")
+	}
+
+	if err := registry.UnRegister("10.0.0.1:8080"); err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, cc, 0)
+}
+
+func TestConsulHealthProbe(t *testing.T) {
+	var (
+		agent   = newFakeAgent()
+		server  = httptest.NewServer(agent)
+		cc      = &clientConn{states: make(chan resolver.State, 10)}
+		healthy = make(chan error, 1)
+		probe   = func() error {
+			select {
+			case err := <-healthy:
+				return err
+			default:
+				return nil
+			}
+		}
+	)
+	defer server.Close()
+
+	registry := New(server.URL, "demo.svc", WithWaitTime(time.Second))
+	registry.(naming.HealthReporter).SetHealthProbe(probe)
+	r, err := registry.Build(resolver.Target{Scheme: registry.Scheme(), Endpoint: "demo.svc"}, cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if err := registry.Register("10.0.0.1:8080", 1); err != nil {
+		t.Fatal(err)
+	}
+	defer registry.UnRegister("10.0.0.1:8080")
+	waitState(t, cc, 1)
+
+	// probe fails once, service is removed then comes back on next heartbeat
+	healthy <- errors.New("database is down")
+	waitState(t, cc, 0)
+	waitState(t, cc, 1)
+}
@@ -0,0 +1,173 @@
+package consul
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/whatvn/denny/naming"
+)
+
+type agentCheck struct {
+	CheckID                        string `json:",omitempty"`
+	TTL                            string `json:",omitempty"`
+	HTTP                           string `json:",omitempty"`
+	Interval                       string `json:",omitempty"`
+	DeregisterCriticalServiceAfter string `json:",omitempty"`
+}
+
+type agentService struct {
+	ID      string
+	Name    string
+	Tags    []string          `json:",omitempty"`
+	Meta    map[string]string `json:",omitempty"`
+	Address string
+	Port    int
+	Check   *agentCheck
+}
+
+func serviceID(name, addr string) string {
+	return name + "-" + addr
+}
+
+// Register registers service with local consul agent, by default a TTL check is attached
+// and passed every ttl seconds, if http check is configured, consul agent will probe service itself
+func (r *consul) Register(addr string, ttl int) error {
+	return r.RegisterService(naming.Service{Name: r.serviceName, Addr: addr, TTL: ttl})
+}
+
+// RegisterService implements naming.ServiceRegistry, metadata is registered as consul service meta
+func (r *consul) RegisterService(svc naming.Service) error {
+	svc = svc.WithDefaults()
+	var (
+		addr = svc.Addr
+		ttl  = svc.TTL
+	)
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return err
+	}
+
+	var (
+		id    = serviceID(svc.Name, addr)
+		check = &agentCheck{
+			CheckID:                        "service:" + id,
+			DeregisterCriticalServiceAfter: r.opts.deregisterAfter.String(),
+		}
+		useTTL = len(r.opts.checkHTTP) == 0
+	)
+	if useTTL {
+		check.TTL = (time.Duration(ttl*2) * time.Second).String()
+	} else {
+		check.HTTP = r.opts.checkHTTP
+		check.Interval = r.opts.checkInterval.String()
+	}
+
+	body, err := json.Marshal(agentService{
+		ID:      id,
+		Name:    svc.Name,
+		Tags:    r.opts.tags,
+		Meta:    svc.Metadata,
+		Address: host,
+		Port:    port,
+		Check:   check,
+	})
+	if err != nil {
+		return err
+	}
+
+	r.Infof("register %s with registy", id)
+	resp, err := r.do(context.Background(), http.MethodPut, "/v1/agent/service/register", bytes.NewReader(body))
+	if err != nil {
+		r.Errorf("error %v", err)
+		return err
+	}
+	_ = resp.Body.Close()
+
+	if !useTTL {
+		return nil
+	}
+	if err = r.report(check.CheckID); err != nil {
+		r.Errorf("error %v", err)
+	}
+
+	shutdown := make(chan struct{})
+	r.Lock()
+	if previous, ok := r.shutdown[id]; ok {
+		close(previous)
+	}
+	r.shutdown[id] = shutdown
+	r.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(time.Second * time.Duration(ttl))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := r.report(check.CheckID); err != nil {
+					r.Errorf("error %v", err)
+				}
+			case <-shutdown:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// report runs health probe and updates TTL check accordingly, consul stops returning
+// service from health queries while its check is critical
+func (r *consul) report(checkID string) error {
+	var (
+		path = "/v1/agent/check/pass/" + checkID
+	)
+	if r.probe != nil {
+		if err := r.probe(); err != nil {
+			r.Warnf("health probe failed, mark %s as critical: %v", checkID, err)
+			path = "/v1/agent/check/fail/" + checkID + "?note=" + url.QueryEscape(err.Error())
+		}
+	}
+	resp, err := r.do(context.Background(), http.MethodPut, path, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// SetHealthProbe implements naming.HealthReporter, probe is used with TTL check only,
+// http check is evaluated by consul agent itself
+func (r *consul) SetHealthProbe(probe naming.HealthProbe) {
+	r.probe = probe
+}
+
+// UnRegister stops heartbeat goroutine and deregisters service from consul agent
+func (r *consul) UnRegister(addr string) error {
+	return r.UnRegisterService(r.serviceName, addr)
+}
+
+// UnRegisterService implements naming.ServiceRegistry
+func (r *consul) UnRegisterService(name, addr string) error {
+	id := serviceID(name, addr)
+	r.Lock()
+	if shutdown, ok := r.shutdown[id]; ok {
+		close(shutdown)
+		delete(r.shutdown, id)
+	}
+	r.Unlock()
+
+	resp, err := r.do(context.Background(), http.MethodPut, "/v1/agent/service/deregister/"+id, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
@@ -0,0 +1,82 @@
+package consul
+
+import (
+	"net/http"
+	"time"
+)
+
+const (
+	defaultWaitTime        = 30 * time.Second
+	defaultDeregisterAfter = time.Minute
+)
+
+type options struct {
+	token           string
+	httpClient      *http.Client
+	waitTime        time.Duration
+	deregisterAfter time.Duration
+	// when checkHTTP is set, consul agent probes this url instead of
+	// waiting for TTL heartbeat from registered service
+	checkHTTP     string
+	checkInterval time.Duration
+	tags          []string
+}
+
+// Option configures consul naming registry
+type Option func(*options)
+
+// WithToken sets consul ACL token sent with every request
+func WithToken(token string) Option {
+	return func(o *options) {
+		o.token = token
+	}
+}
+
+// WithHTTPClient replaces default http client used to talk to consul agent
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = client
+	}
+}
+
+// WithWaitTime sets maximum duration a blocking query waits for changes
+func WithWaitTime(d time.Duration) Option {
+	return func(o *options) {
+		o.waitTime = d
+	}
+}
+
+// WithDeregisterAfter sets how long a service stays critical before consul removes it
+func WithDeregisterAfter(d time.Duration) Option {
+	return func(o *options) {
+		o.deregisterAfter = d
+	}
+}
+
+// WithHTTPCheck uses consul HTTP health check with given url and interval
+// instead of default TTL check
+func WithHTTPCheck(url string, interval time.Duration) Option {
+	return func(o *options) {
+		o.checkHTTP = url
+		o.checkInterval = interval
+	}
+}
+
+// WithTags sets tags of registered service
+func WithTags(tags ...string) Option {
+	return func(o *options) {
+		o.tags = tags
+	}
+}
+
+func newOptions(opts ...Option) *options {
+	o := &options{
+		httpClient:      http.DefaultClient,
+		waitTime:        defaultWaitTime,
+		deregisterAfter: defaultDeregisterAfter,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
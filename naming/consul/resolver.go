@@ -0,0 +1,120 @@
+package consul
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/whatvn/denny/naming"
+	"google.golang.org/grpc/resolver"
+)
+
+const retryInterval = time.Second
+
+type serviceEntry struct {
+	Node struct {
+		Address string
+	}
+	Service struct {
+		Address string
+		Port    int
+	}
+}
+
+// Build implements grpc Builder.Build method so grpc client know how to construct resolver Builder
+func (r *consul) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	r.cc = cc
+	r.WithFields(map[string]interface{}{
+		"scheme":   target.Scheme,
+		"endpoint": target.Endpoint,
+	})
+	go r.watch(target.Endpoint)
+	return r, nil
+}
+
+// watch uses consul blocking queries on health endpoint, only instances
+// with passing checks are returned to grpc client
+func (r *consul) watch(serviceName string) {
+	var index uint64
+	for {
+		addrList, newIndex, err := r.healthyAddresses(serviceName, index)
+		select {
+		case <-r.ctx.Done():
+			return
+		default:
+		}
+		if err != nil {
+			r.Errorf("cannot get address list: %v", err)
+			select {
+			case <-r.ctx.Done():
+				return
+			case <-time.After(retryInterval):
+			}
+			continue
+		}
+		if newIndex != index {
+			r.cc.UpdateState(resolver.State{Addresses: addrList})
+		}
+		// index must only increase, reset it if consul goes backward (eg: after snapshot restore)
+		if newIndex < index {
+			newIndex = 0
+		}
+		index = newIndex
+	}
+}
+
+func (r *consul) healthyAddresses(serviceName string, index uint64) ([]resolver.Address, uint64, error) {
+	query := url.Values{}
+	query.Set("passing", "true")
+	query.Set("wait", r.opts.waitTime.String())
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+	}
+	resp, err := r.do(r.ctx, http.MethodGet, "/v1/health/service/"+url.PathEscape(serviceName)+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, index, err
+	}
+	defer resp.Body.Close()
+
+	var entries []serviceEntry
+	if err = json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, index, err
+	}
+	newIndex, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+
+	var addrList []resolver.Address
+	for _, e := range entries {
+		host := e.Service.Address
+		if len(host) == 0 {
+			host = e.Node.Address
+		}
+		addr := net.JoinHostPort(host, strconv.Itoa(e.Service.Port))
+		if !naming.Exist(addrList, addr) {
+			addrList = append(addrList, resolver.Address{Addr: addr})
+		}
+	}
+	return addrList, newIndex, nil
+}
+
+// Scheme implements Builder.Scheme method to get prefix hint for grpc resolver
+func (r *consul) Scheme() string {
+	return naming.Prefix
+}
+
+// SvcName is shortcut for client's user, it return full service url
+// so clients does not have to construct service url themself
+func (r *consul) SvcName() string {
+	return r.Scheme() + ":///" + r.serviceName
+}
+
+// ResolveNow is no-op, blocking query returns as soon as service list changes
+func (r *consul) ResolveNow(rn resolver.ResolveNowOptions) {
+}
+
+// Close stops watch goroutine
+func (r *consul) Close() {
+	r.closeOnce.Do(r.cancel)
+}
@@ -0,0 +1,186 @@
+// package dns is read-only naming registry which resolves service addresses
+// from SRV or A/AAAA records and refreshes them periodically
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/whatvn/denny/log"
+	"github.com/whatvn/denny/naming"
+	"google.golang.org/grpc/resolver"
+)
+
+type dns struct {
+	*log.Log
+	serviceName string
+	opts        *options
+	cc          resolver.ClientConn
+	refresh     chan struct{}
+	done        chan struct{}
+	closeOnce   sync.Once
+}
+
+// New dns
+// implement github.com/whatvn/denny/naming#Registry
+// serviceName is host:port when A/AAAA records are used, or domain name when
+// SRV records are used (port is then taken from SRV records)
+func New(serviceName string, opts ...Option) naming.Registry {
+	if len(serviceName) == 0 {
+		panic(errors.New("invalid service name"))
+	}
+	registry := &dns{
+		Log:         log.New(),
+		serviceName: serviceName,
+		opts:        newOptions(opts...),
+		refresh:     make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}
+	registry.WithField("dns", serviceName)
+	return registry
+}
+
+// NewResolver is alias to New(), and also register resolver automatically
+// so client does not have to call register resolver everytime
+func NewResolver(serviceName string, opts ...Option) naming.Registry {
+	registry := New(serviceName, opts...)
+	resolver.Register(registry)
+	return registry
+}
+
+// Register does nothing, dns records are managed outside of denny
+func (r *dns) Register(addr string, ttl int) error {
+	r.Infof("dns registry is read-only, skip registering %s", addr)
+	return nil
+}
+
+// UnRegister does nothing, see Register
+func (r *dns) UnRegister(addr string) error {
+	return nil
+}
+
+// Build implements grpc Builder.Build method so grpc client know how to construct resolver Builder
+func (r *dns) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	r.cc = cc
+	r.WithFields(map[string]interface{}{
+		"scheme":   target.Scheme,
+		"endpoint": target.Endpoint,
+	})
+	go r.watch(target.Endpoint)
+	return r, nil
+}
+
+func (r *dns) watch(name string) {
+	var (
+		ticker   = time.NewTicker(r.opts.refreshInterval)
+		addrList []string
+		first    = true
+	)
+	defer ticker.Stop()
+	for {
+		updated, err := r.lookup(name)
+		if err != nil {
+			r.Errorf("cannot lookup %s: %v", name, err)
+			r.cc.ReportError(err)
+		} else if first || !equal(addrList, updated) {
+			first = false
+			addrList = updated
+			state := resolver.State{}
+			for _, addr := range addrList {
+				state.Addresses = append(state.Addresses, resolver.Address{Addr: addr})
+			}
+			r.cc.UpdateState(state)
+		}
+
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+		case <-r.refresh:
+		}
+	}
+}
+
+// lookup returns sorted host:port list of given name
+func (r *dns) lookup(name string) ([]string, error) {
+	var (
+		ctx, cancel = context.WithTimeout(context.Background(), r.opts.timeout)
+		addrs       []string
+	)
+	defer cancel()
+
+	if len(r.opts.srvService) > 0 {
+		_, records, err := r.opts.resolver.LookupSRV(ctx, r.opts.srvService, r.opts.srvProto, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, srv := range records {
+			hosts, err := r.opts.resolver.LookupHost(ctx, srv.Target)
+			if err != nil {
+				return nil, err
+			}
+			for _, host := range hosts {
+				addrs = append(addrs, net.JoinHostPort(host, strconv.Itoa(int(srv.Port))))
+			}
+		}
+	} else {
+		host, port, err := net.SplitHostPort(name)
+		if err != nil {
+			return nil, err
+		}
+		hosts, err := r.opts.resolver.LookupHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, h := range hosts {
+			addrs = append(addrs, net.JoinHostPort(h, port))
+		}
+	}
+	sort.Strings(addrs)
+	return addrs, nil
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Scheme implements Builder.Scheme method to get prefix hint for grpc resolver
+func (r *dns) Scheme() string {
+	return naming.Prefix
+}
+
+// SvcName is shortcut for client's user, it return full service url
+// so clients does not have to construct service url themself
+func (r *dns) SvcName() string {
+	return r.Scheme() + ":///" + r.serviceName
+}
+
+// ResolveNow forces resolver to lookup dns records immediately
+func (r *dns) ResolveNow(rn resolver.ResolveNowOptions) {
+	select {
+	case r.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops refresh goroutine
+func (r *dns) Close() {
+	r.closeOnce.Do(func() {
+		close(r.done)
+	})
+}
+
+var _ naming.Registry = new(dns)
@@ -0,0 +1,48 @@
+package dns
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+type clientConn struct {
+	states chan resolver.State
+}
+
+func (c *clientConn) UpdateState(s resolver.State)  { c.states <- s }
+func (c *clientConn) ReportError(error)             {}
+func (c *clientConn) NewAddress([]resolver.Address) {}
+func (c *clientConn) NewServiceConfig(string)       {}
+func (c *clientConn) ParseServiceConfig(string) *serviceconfig.ParseResult {
+	return nil
+}
+
+func TestDnsRegistry(t *testing.T) {
+	var (
+		registry = New("localhost:8080", WithRefreshInterval(time.Second))
+		cc       = &clientConn{states: make(chan resolver.State, 10)}
+	)
+	r, err := registry.Build(resolver.Target{Scheme: registry.Scheme(), Endpoint: "localhost:8080"}, cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	select {
+	case s := <-cc.states:
+		found := false
+		for _, addr := range s.Addresses {
+			if addr.Addr == "127.0.0.1:8080" || addr.Addr == "[::1]:8080" {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expect localhost address, got %v", s.Addresses)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("expect address list")
+	}
+}
@@ -0,0 +1,64 @@
+package dns
+
+import (
+	"net"
+	"time"
+)
+
+const defaultRefreshInterval = 30 * time.Second
+
+type options struct {
+	refreshInterval time.Duration
+	resolver        *net.Resolver
+	// srv service and proto, eg: "grpc" and "tcp" to lookup _grpc._tcp.<name>
+	srvService string
+	srvProto   string
+	timeout    time.Duration
+}
+
+// Option configures dns naming registry
+type Option func(*options)
+
+// WithRefreshInterval sets how often dns records are looked up again
+func WithRefreshInterval(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.refreshInterval = d
+		}
+	}
+}
+
+// WithResolver replaces default net resolver, eg: to query a specific dns server
+func WithResolver(r *net.Resolver) Option {
+	return func(o *options) {
+		o.resolver = r
+	}
+}
+
+// WithSRV resolves addresses from SRV records _service._proto.name
+// instead of A/AAAA records
+func WithSRV(service, proto string) Option {
+	return func(o *options) {
+		o.srvService = service
+		o.srvProto = proto
+	}
+}
+
+// WithTimeout sets timeout of one lookup
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+func newOptions(opts ...Option) *options {
+	o := &options{
+		refreshInterval: defaultRefreshInterval,
+		resolver:        net.DefaultResolver,
+		timeout:         5 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
@@ -2,44 +2,35 @@ package etcd
 
 import (
 	"errors"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/whatvn/denny/log"
 	"github.com/whatvn/denny/naming"
 	"go.etcd.io/etcd/clientv3"
 	"google.golang.org/grpc/resolver"
-	"strings"
-	"time"
 )
 
 type etcd struct {
 	cli *clientv3.Client
 	*log.Log
-	shutdown    chan interface{}
 	cc          resolver.ClientConn
 	serviceName string
+	probe       naming.HealthProbe
+	// registrations keyed by etcd key, each one holds its own lease
+	mu            sync.Mutex
+	registrations map[string]*registration
 }
 
 // New etcd
 // implement github.com/whatvn/denny/naming#Registry
 // with 2 methods: Register and UnRegister
 func New(etcdAddrs, serviceName string) naming.Registry {
-
-	cli, err := clientv3.New(clientv3.Config{
+	registry := newRegistry(serviceName, clientv3.Config{
 		Endpoints:   strings.Split(etcdAddrs, ";"),
 		DialTimeout: 15 * time.Second,
 	})
-	if err != nil {
-		panic(err)
-	}
-
-	if len(serviceName) == 0 {
-		panic(errors.New("invalid service name"))
-	}
-	registry := &etcd{
-		cli:         cli,
-		Log:         log.New(),
-		serviceName: serviceName,
-		shutdown:    make(chan interface{}, 1),
-	}
 	registry.WithField("etcd", etcdAddrs)
 	return registry
 }
@@ -48,7 +39,12 @@ func New(etcdAddrs, serviceName string) naming.Registry {
 // implement github.com/whatvn/denny/naming#Registry
 // with 2 methods: Register and UnRegister
 func NewWithClientConfig(serviceName string, etcdClientCfg clientv3.Config) naming.Registry {
+	registry := newRegistry(serviceName, etcdClientCfg)
+	registry.WithField("etcd", etcdClientCfg.Endpoints)
+	return registry
+}
 
+func newRegistry(serviceName string, etcdClientCfg clientv3.Config) *etcd {
 	cli, err := clientv3.New(etcdClientCfg)
 	if err != nil {
 		panic(err)
@@ -57,14 +53,16 @@ func NewWithClientConfig(serviceName string, etcdClientCfg clientv3.Config) nami
 	if len(serviceName) == 0 {
 		panic(errors.New("invalid service name"))
 	}
-	registry := &etcd{
-		cli:         cli,
-		Log:         log.New(),
-		serviceName: serviceName,
-		shutdown:    make(chan interface{}, 1),
+	return &etcd{
+		cli:           cli,
+		Log:           log.New(),
+		serviceName:   serviceName,
+		registrations: make(map[string]*registration),
 	}
-	registry.WithField("etcd", etcdClientCfg.Endpoints)
-	return registry
 }
 
-var _ naming.Registry = new(etcd)
+var (
+	_ naming.Registry        = new(etcd)
+	_ naming.ServiceRegistry = new(etcd)
+	_ naming.HealthReporter  = new(etcd)
+)
@@ -2,75 +2,192 @@ package etcd
 
 import (
 	"context"
+	"time"
+
 	"github.com/whatvn/denny/naming"
 	"go.etcd.io/etcd/clientv3"
-	"time"
 )
 
-// Register starts etcd client and check for registered key, if it's not available
-// in etcd storage, it will write service host:port to etcd and start watching to keep writing
-// if its data is not available again
+const (
+	retryInterval  = time.Second
+	requestTimeout = 5 * time.Second
+)
+
+// registration is state of one registered address, it owns a single lease
+// which is kept alive until UnRegister revokes it
+type registration struct {
+	addr     string
+	key      string
+	ttl      int
+	metadata map[string]string
+	lease    clientv3.LeaseID
+	healthy  bool
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// Register writes service host:port to etcd attached to a lease and keeps the lease alive,
+// if the lease is lost (eg: etcd session expired while network is partitioned),
+// a new lease is granted and the key is written again
 func (r *etcd) Register(addr string, ttl int) error {
+	return r.RegisterService(naming.Service{Name: r.serviceName, Addr: addr, TTL: ttl})
+}
 
-	var (
-		ticker  = time.NewTicker(time.Second * time.Duration(ttl))
-		err     error
-		svcPath = "/" + naming.Prefix + "/" + r.serviceName + "/" + addr
-	)
+// RegisterService implements naming.ServiceRegistry, it works the same as Register
+// but registers address under given service name with its own ttl and metadata
+func (r *etcd) RegisterService(svc naming.Service) error {
+	svc = svc.WithDefaults()
+	key := "/" + naming.Prefix + "/" + svc.Name + "/" + svc.Addr
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.registrations[key]; ok {
+		r.Infof("%s is already registered", key)
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reg := &registration{
+		addr:     svc.Addr,
+		key:      key,
+		ttl:      svc.TTL,
+		metadata: svc.Metadata,
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	r.registrations[key] = reg
 
-	r.Infof("register %s with registy", svcPath)
-	err = r.register(addr, ttl)
+	r.Infof("register %s with registy", reg.key)
+	ch, err := r.grant(reg)
 	if err != nil {
+		// keep going, lease is granted again in background
 		r.Errorf("error %v", err)
 	}
+	go r.keepAlive(reg, ch)
+	return nil
+}
 
-	go func() {
-		for {
+// grant creates new lease, writes registration key with it and starts keepalive,
+// returned channel is closed when lease can no longer be kept alive
+func (r *etcd) grant(reg *registration) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	ctx, cancel := context.WithTimeout(reg.ctx, requestTimeout)
+	defer cancel()
+
+	leaseResp, err := r.cli.Grant(ctx, int64(reg.ttl))
+	if err != nil {
+		return nil, err
+	}
+	reg.lease = leaseResp.ID
+	reg.healthy = r.probe.Healthy()
+
+	if err = r.put(ctx, reg); err != nil {
+		_, _ = r.cli.Revoke(context.Background(), leaseResp.ID)
+		return nil, err
+	}
+	return r.cli.KeepAlive(reg.ctx, leaseResp.ID)
+}
+
+func (r *etcd) put(ctx context.Context, reg *registration) error {
+	endpoint := naming.Endpoint{Addr: reg.addr, Healthy: reg.healthy, Metadata: reg.metadata}
+	_, err := r.cli.Put(ctx, reg.key, endpoint.Encode(), clientv3.WithLease(reg.lease))
+	return err
+}
+
+// keepAlive drains keepalive responses so etcd client does not complain about full channel,
+// re-establishes lease when it's lost and refreshes health status every ttl seconds
+func (r *etcd) keepAlive(reg *registration, ch <-chan *clientv3.LeaseKeepAliveResponse) {
+	var (
+		ticker = time.NewTicker(time.Second * time.Duration(reg.ttl))
+		err    error
+	)
+	defer close(reg.done)
+	defer ticker.Stop()
+
+	for {
+		if ch == nil {
 			select {
-			case _ = <-ticker.C:
-				resp, err := r.cli.Get(context.Background(), svcPath)
-				if err != nil {
-					r.Errorf("error %v", err)
-				} else if resp.Count == 0 {
-					err = r.register(addr, ttl)
-					if err != nil {
-						r.Errorf("error %v", err)
-					}
-				}
-			case _ = <-r.shutdown:
-				// receive message from shutdown channel
-				// will stop current thread and stop ticker to prevent thread leak
-				ticker.Stop()
+			case <-reg.ctx.Done():
 				return
+			case <-time.After(retryInterval):
+			}
+			if ch, err = r.grant(reg); err != nil {
+				r.Errorf("error %v", err)
+				continue
 			}
+			r.Infof("lease of %s is re-established", reg.key)
 		}
-	}()
 
-	return nil
+		select {
+		case <-reg.ctx.Done():
+			return
+		case _, ok := <-ch:
+			if !ok {
+				r.Warnf("lease of %s is lost", reg.key)
+				ch = nil
+			}
+		case <-ticker.C:
+			r.refresh(reg)
+		}
+	}
 }
 
-func (r *etcd) register(addr string, ttl int) error {
-	leaseResp, err := r.cli.Grant(context.Background(), int64(ttl))
-	if err != nil {
-		return err
-	}
+// refresh writes key again with current lease when health status changes
+// or key was deleted by someone else
+func (r *etcd) refresh(reg *registration) {
+	ctx, cancel := context.WithTimeout(reg.ctx, requestTimeout)
+	defer cancel()
 
-	_, err = r.cli.Put(context.Background(), "/"+naming.Prefix+"/"+r.serviceName+"/"+addr, addr, clientv3.WithLease(leaseResp.ID))
+	resp, err := r.cli.Get(ctx, reg.key)
 	if err != nil {
-		return err
+		r.Errorf("error %v", err)
+		return
 	}
-
-	_, err = r.cli.KeepAlive(context.Background(), leaseResp.ID)
-	if err != nil {
-		return err
+	healthy := r.probe.Healthy()
+	if resp.Count > 0 && healthy == reg.healthy {
+		return
 	}
-	return nil
+	if !healthy {
+		r.Warnf("health probe failed, mark %s as unhealthy", reg.key)
+	}
+	reg.healthy = healthy
+	if err = r.put(ctx, reg); err != nil {
+		r.Errorf("error %v", err)
+	}
+}
+
+// SetHealthProbe implements naming.HealthReporter
+func (r *etcd) SetHealthProbe(probe naming.HealthProbe) {
+	r.probe = probe
 }
 
-// UnRegister deletes itself in etcd storage
-// also stop watch goroutine and ticker inside it
+// UnRegister stops keepalive goroutine of given address and revokes its lease,
+// which also deletes registered key from etcd storage
 func (r *etcd) UnRegister(addr string) error {
-	_, _ = r.cli.Delete(context.Background(), "/"+naming.Prefix+"/"+r.serviceName+"/"+addr)
-	r.shutdown <- "stop"
-	return nil
+	return r.UnRegisterService(r.serviceName, addr)
+}
+
+// UnRegisterService implements naming.ServiceRegistry
+func (r *etcd) UnRegisterService(name, addr string) error {
+	key := "/" + naming.Prefix + "/" + name + "/" + addr
+	r.mu.Lock()
+	reg, ok := r.registrations[key]
+	delete(r.registrations, key)
+	r.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	reg.cancel()
+	<-reg.done
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	if reg.lease != clientv3.NoLease {
+		if _, err := r.cli.Revoke(ctx, reg.lease); err != nil {
+			return err
+		}
+	}
+	_, err := r.cli.Delete(ctx, reg.key)
+	return err
 }
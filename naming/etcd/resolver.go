@@ -42,24 +42,24 @@ func (r *etcd) Build(target resolver.Target, cc resolver.ClientConn, opts resolv
 }
 
 // Scheme implements Builder.Scheme method to get prefix hint for grpc resolver
-func (r etcd) Scheme() string {
+func (r *etcd) Scheme() string {
 	return naming.Prefix
 }
 
 // SvcName is shortcut for client's user, it return full service url
 // so clients does not have to construct service url themself
-func (r etcd) SvcName() string {
+func (r *etcd) SvcName() string {
 	return r.Scheme() + ":///" + r.serviceName
 }
 
 // ResolveNow force grpc clients to resolve service address immediately
 // it's TODO implementation
-func (r etcd) ResolveNow(rn resolver.ResolveNowOptions) {
+func (r *etcd) ResolveNow(rn resolver.ResolveNowOptions) {
 	// will force to update address list immediately
 }
 
 // Close closes the resolver.
-func (r etcd) Close() {
+func (r *etcd) Close() {
 	_ = r.cli.Close()
 }
 
@@ -71,6 +71,9 @@ func (r *etcd) watch(keyPrefix string) {
 		r.Errorf("error %v", err)
 	} else {
 		for i := range resp.Kvs {
+			if !naming.DecodeEndpoint(string(resp.Kvs[i].Value)).Healthy {
+				continue
+			}
 			addrList = append(addrList, resolver.Address{Addr: strings.TrimPrefix(string(resp.Kvs[i].Key), keyPrefix)})
 		}
 	}
@@ -85,6 +88,14 @@ func (r *etcd) watch(keyPrefix string) {
 			addr := strings.TrimPrefix(string(ev.Kv.Key), keyPrefix)
 			switch ev.Type {
 			case mvccpb.PUT:
+				if !naming.DecodeEndpoint(string(ev.Kv.Value)).Healthy {
+					// registered service reports unhealthy, stop routing to it
+					if s, ok := naming.Remove(addrList, addr); ok {
+						addrList = s
+						r.cc.UpdateState(resolver.State{Addresses: addrList})
+					}
+					continue
+				}
 				if !naming.Exist(addrList, addr) {
 					addrList = append(addrList, resolver.Address{Addr: addr})
 					r.cc.UpdateState(resolver.State{Addresses: addrList})
@@ -0,0 +1,45 @@
+package naming
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// HealthProbe reports whether registered service is able to serve requests,
+// a non-nil error marks service as unhealthy
+type HealthProbe func() error
+
+// HealthReporter is implemented by registries which can advertise health of registered service,
+// registry runs probe before every refresh, unhealthy entries are kept in storage but marked so
+// resolvers stop routing to them, they are marked healthy again once probe succeeds
+type HealthReporter interface {
+	SetHealthProbe(probe HealthProbe)
+}
+
+// Endpoint is value stored in naming storage for every registered address
+type Endpoint struct {
+	Addr     string            `json:"addr"`
+	Healthy  bool              `json:"healthy"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Encode returns json representation of endpoint
+func (e Endpoint) Encode() string {
+	b, _ := json.Marshal(e)
+	return string(b)
+}
+
+// DecodeEndpoint parses value stored in naming storage, value written by older version
+// is plain address and considered healthy
+func DecodeEndpoint(value string) Endpoint {
+	var e Endpoint
+	if strings.HasPrefix(value, "{") && json.Unmarshal([]byte(value), &e) == nil {
+		return e
+	}
+	return Endpoint{Addr: value, Healthy: true}
+}
+
+// Healthy runs probe and returns true if probe is nil or succeeds
+func (p HealthProbe) Healthy() bool {
+	return p == nil || p() == nil
+}
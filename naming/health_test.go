@@ -0,0 +1,29 @@
+package naming
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDecodeEndpoint(t *testing.T) {
+	// value written by older version is plain address
+	if e := DecodeEndpoint("10.0.0.1:8080"); e.Addr != "10.0.0.1:8080" || !e.Healthy {
+		t.Errorf("unexpected endpoint %+v", e)
+	}
+
+	e := Endpoint{Addr: "10.0.0.1:8080", Metadata: map[string]string{"zone": "a"}}
+	if d := DecodeEndpoint(e.Encode()); d.Healthy || d.Metadata["zone"] != "a" {
+		t.Errorf("unexpected endpoint %+v", d)
+	}
+}
+
+func TestHealthProbe(t *testing.T) {
+	var probe HealthProbe
+	if !probe.Healthy() {
+		t.Error("nil probe should be healthy")
+	}
+	probe = func() error { return errors.New("down") }
+	if probe.Healthy() {
+		t.Error("failed probe should be unhealthy")
+	}
+}
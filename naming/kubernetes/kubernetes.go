@@ -0,0 +1,159 @@
+// package kubernetes is a read-only naming registry which resolves grpc service addresses
+// from kubernetes Endpoints or EndpointSlices, registration is handled by kubernetes itself
+package kubernetes
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/whatvn/denny/log"
+	"github.com/whatvn/denny/naming"
+	"google.golang.org/grpc/resolver"
+)
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount/"
+	defaultNamespace  = "default"
+)
+
+type kubernetes struct {
+	*log.Log
+	serviceName string
+	opts        *options
+	cc          resolver.ClientConn
+	ctx         context.Context
+	cancel      context.CancelFunc
+	closeOnce   sync.Once
+}
+
+// New kubernetes
+// implement github.com/whatvn/denny/naming#Registry
+// serviceName is name of kubernetes Service, when no option is given, api server address,
+// credential and namespace are read from in-cluster environment
+func New(serviceName string, opts ...Option) naming.Registry {
+	if len(serviceName) == 0 {
+		panic(errors.New("invalid service name"))
+	}
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if err := inClusterDefaults(o); err != nil {
+		panic(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	registry := &kubernetes{
+		Log:         log.New(),
+		serviceName: serviceName,
+		opts:        o,
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+	registry.WithFields(map[string]interface{}{
+		"kubernetes": o.apiServer,
+		"namespace":  o.namespace,
+	})
+	return registry
+}
+
+// NewResolver is alias to New(), and also register resolver automatically
+// so client does not have to call register resolver everytime
+func NewResolver(serviceName string, opts ...Option) naming.Registry {
+	registry := New(serviceName, opts...)
+	resolver.Register(registry)
+	return registry
+}
+
+// inClusterDefaults fills options which are not given by caller from pod environment
+func inClusterDefaults(o *options) error {
+	if len(o.apiServer) == 0 {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if len(host) == 0 || len(port) == 0 {
+			return errors.New("kubernetes api server address is not available")
+		}
+		o.apiServer = "https://" + net.JoinHostPort(host, port)
+	}
+	o.apiServer = strings.TrimSuffix(o.apiServer, "/")
+
+	if len(o.token) == 0 {
+		if _, err := os.Stat(serviceAccountDir + "token"); err == nil {
+			o.tokenFile = serviceAccountDir + "token"
+		}
+	}
+
+	if len(o.namespace) == 0 {
+		o.namespace = defaultNamespace
+		if ns, err := ioutil.ReadFile(serviceAccountDir + "namespace"); err == nil {
+			o.namespace = strings.TrimSpace(string(ns))
+		}
+	}
+
+	if o.httpClient == nil {
+		o.httpClient = http.DefaultClient
+		if ca, err := ioutil.ReadFile(serviceAccountDir + "ca.crt"); err == nil {
+			pool := x509.NewCertPool()
+			pool.AppendCertsFromPEM(ca)
+			o.httpClient = &http.Client{
+				Transport: &http.Transport{
+					Proxy:           http.ProxyFromEnvironment,
+					TLSClientConfig: &tls.Config{RootCAs: pool},
+				},
+			}
+		}
+	}
+	return nil
+}
+
+// Register does nothing, kubernetes manages endpoints of a service
+// based on its pod selector and readiness probe
+func (r *kubernetes) Register(addr string, ttl int) error {
+	r.Infof("kubernetes registry is read-only, skip registering %s", addr)
+	return nil
+}
+
+// UnRegister does nothing, see Register
+func (r *kubernetes) UnRegister(addr string) error {
+	return nil
+}
+
+// get sends GET request to api server, caller has to close response body
+func (r *kubernetes) get(path string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, r.opts.apiServer+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(r.ctx)
+	token := r.opts.token
+	if len(token) == 0 && len(r.opts.tokenFile) > 0 {
+		// service account token is rotated by kubelet, always read the latest one
+		if b, err := ioutil.ReadFile(r.opts.tokenFile); err == nil {
+			token = strings.TrimSpace(string(b))
+		}
+	}
+	if len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := r.opts.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("kubernetes: GET %s: %d %s", path, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+var _ naming.Registry = new(kubernetes)
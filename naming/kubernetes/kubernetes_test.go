@@ -0,0 +1,112 @@
+package kubernetes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+type clientConn struct {
+	states chan resolver.State
+}
+
+func (c *clientConn) UpdateState(s resolver.State)  { c.states <- s }
+func (c *clientConn) ReportError(error)             {}
+func (c *clientConn) NewAddress([]resolver.Address) {}
+func (c *clientConn) NewServiceConfig(string)       {}
+func (c *clientConn) ParseServiceConfig(string) *serviceconfig.ParseResult {
+	return nil
+}
+
+const (
+	endpointsList = `{"metadata":{"resourceVersion":"10"},"items":[{"metadata":{"name":"demo"},
+"subsets":[{"addresses":[{"ip":"10.0.0.1"}],"notReadyAddresses":[{"ip":"10.0.0.9"}],"ports":[{"name":"grpc","port":8080}]}]}]}`
+	endpointsEvent = `{"type":"MODIFIED","object":{"metadata":{"name":"demo"},
+"subsets":[{"addresses":[{"ip":"10.0.0.1"},{"ip":"fd00::2"}],"ports":[{"name":"metrics","port":9090},{"name":"grpc","port":8080}]}]}}`
+	sliceList = `{"metadata":{"resourceVersion":"3"},"items":[
+{"metadata":{"name":"demo-a"},"ports":[{"name":"grpc","port":8080}],"endpoints":[{"addresses":["10.0.0.1"],"conditions":{"ready":true}},{"addresses":["10.0.0.2"],"conditions":{"ready":false}}]},
+{"metadata":{"name":"demo-b"},"ports":[{"name":"grpc","port":8080}],"endpoints":[{"addresses":["10.0.0.3"]}]}]}`
+)
+
+func fakeAPIServer(t *testing.T, path, list, event string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != path {
+			t.Errorf("unexpected path %s", req.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if req.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if req.URL.Query().Get("watch") != "true" {
+			_, _ = w.Write([]byte(list))
+			return
+		}
+		if len(event) > 0 {
+			_, _ = w.Write([]byte(event + "\n"))
+		}
+		w.(http.Flusher).Flush()
+		<-req.Context().Done()
+	}))
+}
+
+func waitAddresses(t *testing.T, cc *clientConn, addrs ...string) {
+	for {
+		select {
+		case s := <-cc.states:
+			if len(s.Addresses) != len(addrs) {
+				continue
+			}
+			for i := range addrs {
+				if s.Addresses[i].Addr != addrs[i] {
+					t.Fatalf("expect %v, got %v", addrs, s.Addresses)
+				}
+			}
+			return
+		case <-time.After(3 * time.Second):
+			t.Fatalf("expect addresses %v", addrs)
+		}
+	}
+}
+
+func TestKubernetesEndpoints(t *testing.T) {
+	var (
+		server = fakeAPIServer(t, "/api/v1/namespaces/prod/endpoints", endpointsList, endpointsEvent)
+		cc     = &clientConn{states: make(chan resolver.State, 10)}
+	)
+	defer server.Close()
+
+	registry := New("demo", WithAPIServer(server.URL), WithToken("secret"),
+		WithNamespace("prod"), WithPortName("grpc"), WithHTTPClient(server.Client()))
+	r, err := registry.Build(resolver.Target{Scheme: registry.Scheme(), Endpoint: "demo"}, cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	waitAddresses(t, cc, "10.0.0.1:8080")
+	waitAddresses(t, cc, "10.0.0.1:8080", "[fd00::2]:8080")
+}
+
+func TestKubernetesEndpointSlices(t *testing.T) {
+	var (
+		server = fakeAPIServer(t, "/apis/discovery.k8s.io/v1/namespaces/prod/endpointslices", sliceList, "")
+		cc     = &clientConn{states: make(chan resolver.State, 10)}
+	)
+	defer server.Close()
+
+	registry := New("demo", WithAPIServer(server.URL), WithToken("secret"),
+		WithNamespace("prod"), WithEndpointSlices(), WithHTTPClient(server.Client()))
+	r, err := registry.Build(resolver.Target{Scheme: registry.Scheme(), Endpoint: "demo"}, cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	waitAddresses(t, cc, "10.0.0.1:8080", "10.0.0.3:8080")
+}
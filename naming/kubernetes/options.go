@@ -0,0 +1,64 @@
+package kubernetes
+
+import (
+	"net/http"
+)
+
+type options struct {
+	apiServer  string
+	token      string
+	tokenFile  string
+	namespace  string
+	portName   string
+	httpClient *http.Client
+	// resolve from discovery.k8s.io/v1 EndpointSlices instead of core/v1 Endpoints
+	endpointSlices bool
+}
+
+// Option configures kubernetes naming registry
+type Option func(*options)
+
+// WithAPIServer sets kubernetes api server address, eg: https://10.0.0.1:443
+// default is taken from KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT
+func WithAPIServer(addr string) Option {
+	return func(o *options) {
+		o.apiServer = addr
+	}
+}
+
+// WithToken sets bearer token used to authenticate with api server
+// default is service account token mounted in pod
+func WithToken(token string) Option {
+	return func(o *options) {
+		o.token = token
+	}
+}
+
+// WithNamespace sets namespace of resolved service
+// default is namespace of service account mounted in pod, or "default"
+func WithNamespace(namespace string) Option {
+	return func(o *options) {
+		o.namespace = namespace
+	}
+}
+
+// WithPortName selects endpoint port by name, first port is used by default
+func WithPortName(name string) Option {
+	return func(o *options) {
+		o.portName = name
+	}
+}
+
+// WithHTTPClient replaces http client used to talk to api server
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = client
+	}
+}
+
+// WithEndpointSlices resolves addresses from EndpointSlices instead of Endpoints
+func WithEndpointSlices() Option {
+	return func(o *options) {
+		o.endpointSlices = true
+	}
+}
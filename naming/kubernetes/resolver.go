@@ -0,0 +1,254 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/whatvn/denny/naming"
+	"google.golang.org/grpc/resolver"
+)
+
+const retryInterval = time.Second
+
+type (
+	objectMeta struct {
+		Name            string `json:"name"`
+		ResourceVersion string `json:"resourceVersion"`
+	}
+
+	endpointPort struct {
+		Name string `json:"name"`
+		Port int    `json:"port"`
+	}
+
+	// endpoints is subset of core/v1 Endpoints
+	endpoints struct {
+		Metadata objectMeta `json:"metadata"`
+		Subsets  []struct {
+			Addresses []struct {
+				IP string `json:"ip"`
+			} `json:"addresses"`
+			Ports []endpointPort `json:"ports"`
+		} `json:"subsets"`
+	}
+
+	// endpointSlice is subset of discovery.k8s.io/v1 EndpointSlice
+	endpointSlice struct {
+		Metadata  objectMeta `json:"metadata"`
+		Endpoints []struct {
+			Addresses  []string `json:"addresses"`
+			Conditions struct {
+				Ready *bool `json:"ready"`
+			} `json:"conditions"`
+		} `json:"endpoints"`
+		Ports []endpointPort `json:"ports"`
+	}
+
+	objectList struct {
+		Metadata objectMeta        `json:"metadata"`
+		Items    []json.RawMessage `json:"items"`
+	}
+
+	watchEvent struct {
+		Type   string          `json:"type"`
+		Object json.RawMessage `json:"object"`
+	}
+)
+
+// Build implements grpc Builder.Build method so grpc client know how to construct resolver Builder
+func (r *kubernetes) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	r.cc = cc
+	r.WithFields(map[string]interface{}{
+		"scheme":   target.Scheme,
+		"endpoint": target.Endpoint,
+	})
+	go r.watch(target.Endpoint)
+	return r, nil
+}
+
+// resourcePath returns api path of Endpoints or EndpointSlices belong to given service
+func (r *kubernetes) resourcePath(serviceName string, query url.Values) string {
+	if r.opts.endpointSlices {
+		query.Set("labelSelector", "kubernetes.io/service-name="+serviceName)
+		return "/apis/discovery.k8s.io/v1/namespaces/" + r.opts.namespace + "/endpointslices?" + query.Encode()
+	}
+	query.Set("fieldSelector", "metadata.name="+serviceName)
+	return "/api/v1/namespaces/" + r.opts.namespace + "/endpoints?" + query.Encode()
+}
+
+// watch lists current objects then follows api server watch stream,
+// stream is re-established from a fresh list whenever it ends or fails
+func (r *kubernetes) watch(serviceName string) {
+	for {
+		objects, version, err := r.list(serviceName)
+		if err == nil {
+			r.updateState(objects)
+			err = r.follow(serviceName, version, objects)
+		}
+		select {
+		case <-r.ctx.Done():
+			return
+		default:
+		}
+		if err != nil {
+			r.Errorf("cannot watch endpoints: %v", err)
+		}
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// list returns ready addresses keyed by object name and list resource version
+func (r *kubernetes) list(serviceName string) (map[string][]string, string, error) {
+	resp, err := r.get(r.resourcePath(serviceName, url.Values{}))
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	var list objectList
+	if err = json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, "", err
+	}
+	objects := make(map[string][]string)
+	for _, item := range list.Items {
+		name, addrs, err := r.addresses(item)
+		if err != nil {
+			return nil, "", err
+		}
+		objects[name] = addrs
+	}
+	return objects, list.Metadata.ResourceVersion, nil
+}
+
+func (r *kubernetes) follow(serviceName, version string, objects map[string][]string) error {
+	query := url.Values{}
+	query.Set("watch", "true")
+	query.Set("resourceVersion", version)
+	resp, err := r.get(r.resourcePath(serviceName, query))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var ev watchEvent
+		if err := decoder.Decode(&ev); err != nil {
+			return err
+		}
+		switch ev.Type {
+		case "ADDED", "MODIFIED", "DELETED":
+			name, addrs, err := r.addresses(ev.Object)
+			if err != nil {
+				return err
+			}
+			if ev.Type == "DELETED" {
+				delete(objects, name)
+			} else {
+				objects[name] = addrs
+			}
+			r.updateState(objects)
+		case "ERROR":
+			// usually resource version is too old, start over with a new list
+			return errors.New("watch error: " + string(ev.Object))
+		}
+	}
+}
+
+// addresses decodes an Endpoints or EndpointSlice object into ready host:port list
+func (r *kubernetes) addresses(raw json.RawMessage) (string, []string, error) {
+	var addrs []string
+	if r.opts.endpointSlices {
+		var slice endpointSlice
+		if err := json.Unmarshal(raw, &slice); err != nil {
+			return "", nil, err
+		}
+		port, ok := r.selectPort(slice.Ports)
+		if !ok {
+			return slice.Metadata.Name, nil, nil
+		}
+		for _, ep := range slice.Endpoints {
+			if ep.Conditions.Ready != nil && !*ep.Conditions.Ready {
+				continue
+			}
+			for _, ip := range ep.Addresses {
+				addrs = append(addrs, net.JoinHostPort(ip, strconv.Itoa(port)))
+			}
+		}
+		return slice.Metadata.Name, addrs, nil
+	}
+
+	var ep endpoints
+	if err := json.Unmarshal(raw, &ep); err != nil {
+		return "", nil, err
+	}
+	for _, subset := range ep.Subsets {
+		port, ok := r.selectPort(subset.Ports)
+		if !ok {
+			continue
+		}
+		for _, a := range subset.Addresses {
+			addrs = append(addrs, net.JoinHostPort(a.IP, strconv.Itoa(port)))
+		}
+	}
+	return ep.Metadata.Name, addrs, nil
+}
+
+func (r *kubernetes) selectPort(ports []endpointPort) (int, bool) {
+	if len(ports) == 0 {
+		return 0, false
+	}
+	if len(r.opts.portName) == 0 {
+		return ports[0].Port, true
+	}
+	for _, p := range ports {
+		if p.Name == r.opts.portName {
+			return p.Port, true
+		}
+	}
+	return 0, false
+}
+
+func (r *kubernetes) updateState(objects map[string][]string) {
+	var addrList []resolver.Address
+	for _, addrs := range objects {
+		for _, addr := range addrs {
+			if !naming.Exist(addrList, addr) {
+				addrList = append(addrList, resolver.Address{Addr: addr})
+			}
+		}
+	}
+	sort.Slice(addrList, func(i, j int) bool {
+		return addrList[i].Addr < addrList[j].Addr
+	})
+	r.cc.UpdateState(resolver.State{Addresses: addrList})
+}
+
+// Scheme implements Builder.Scheme method to get prefix hint for grpc resolver
+func (r *kubernetes) Scheme() string {
+	return naming.Prefix
+}
+
+// SvcName is shortcut for client's user, it return full service url
+// so clients does not have to construct service url themself
+func (r *kubernetes) SvcName() string {
+	return r.Scheme() + ":///" + r.serviceName
+}
+
+// ResolveNow is no-op, watch stream delivers changes as soon as they happen
+func (r *kubernetes) ResolveNow(rn resolver.ResolveNowOptions) {
+}
+
+// Close stops watch goroutine
+func (r *kubernetes) Close() {
+	r.closeOnce.Do(r.cancel)
+}
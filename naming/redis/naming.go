@@ -1,30 +1,48 @@
 package redis
 
 import (
-	"github.com/whatvn/denny/naming"
 	"time"
+
+	redisCli "github.com/go-redis/redis"
+	"github.com/whatvn/denny/naming"
 )
 
 func (r *redis) Register(addr string, ttl int) error {
+	return r.RegisterService(naming.Service{Name: r.serviceName, Addr: addr, TTL: ttl})
+}
+
+// RegisterService implements naming.ServiceRegistry, it works the same as Register
+// but registers address under given service name with its own ttl and metadata
+func (r *redis) RegisterService(svc naming.Service) error {
+	svc = svc.WithDefaults()
 	var (
-		ticker  = time.NewTicker(time.Second * time.Duration(ttl))
+		ticker  = time.NewTicker(time.Second * time.Duration(svc.TTL))
 		err     error
-		svcPath = "/" + naming.Prefix + "/" + r.serviceName + "/" + addr
+		svcPath = svcPrefix(svc.Name) + svc.Addr
 	)
 
 	r.Infof("register %s with registy", svcPath)
-	err = r.register(addr, ttl)
+	err = r.register(svc)
 	if err != nil {
+		ticker.Stop()
 		r.Errorf("error %v", err)
 		return err
 	}
 
+	shutdown := make(chan struct{})
+	r.mu.Lock()
+	if previous, ok := r.registrations[svcPath]; ok {
+		close(previous)
+	}
+	r.registrations[svcPath] = shutdown
+	r.mu.Unlock()
+
 	go func() {
 		for {
 			select {
 			case _ = <-ticker.C:
-				_ = r.register(addr, ttl)
-			case _ = <-r.shutdown:
+				_ = r.register(svc)
+			case _ = <-shutdown:
 				// receive message from shutdown channel
 				// will stop current thread and stop ticker to prevent thread leak
 				ticker.Stop()
@@ -36,31 +54,54 @@ func (r *redis) Register(addr string, ttl int) error {
 	return nil
 }
 
-func (r *redis) register(addr string, ttl int) error {
+func (r *redis) register(svc naming.Service) error {
 	var (
-		svcPath = "/" + naming.Prefix + "/" + r.serviceName + "/" + addr
+		svcPath  = svcPrefix(svc.Name) + svc.Addr
+		endpoint = naming.Endpoint{Addr: svc.Addr, Healthy: r.probe.Healthy(), Metadata: svc.Metadata}
 	)
 
-	existCmd := r.cli.Exists(svcPath)
-	val, err := existCmd.Result()
-
-	if err != nil {
+	current, err := r.cli.Get(svcPath).Result()
+	if err != nil && err != redisCli.Nil {
 		return err
 	}
 
-	if val != 0 {
-		// increase expired time
-		touchCmd := r.cli.Expire(svcPath, time.Duration(ttl*2)*time.Second)
-		return touchCmd.Err()
+	// always write value to refresh expired time and health status
+	setCmd := r.cli.Set(svcPath, endpoint.Encode(), time.Duration(svc.TTL*2)*time.Second)
+	if err := setCmd.Err(); err != nil {
+		return err
 	}
-	setCmd := r.cli.Set(svcPath, addr, time.Duration(ttl*2)*time.Second)
-	return setCmd.Err()
+	if err != redisCli.Nil && naming.DecodeEndpoint(current).Healthy == endpoint.Healthy {
+		return nil
+	}
+	if !endpoint.Healthy {
+		r.Warnf("health probe failed, mark %s as unhealthy", svcPath)
+	}
+	// new address or health status changed, let resolvers know without waiting for next poll
+	return r.cli.Publish(svcPrefix(svc.Name), svc.Addr).Err()
+}
+
+// SetHealthProbe implements naming.HealthReporter
+func (r *redis) SetHealthProbe(probe naming.HealthProbe) {
+	r.probe = probe
 }
 
 func (r *redis) UnRegister(addr string) error {
+	return r.UnRegisterService(r.serviceName, addr)
+}
+
+// UnRegisterService implements naming.ServiceRegistry
+func (r *redis) UnRegisterService(name, addr string) error {
 	var (
-		svcPath = "/" + naming.Prefix + "/" + r.serviceName + "/" + addr
+		svcPath = svcPrefix(name) + addr
 	)
-	r.shutdown <- "stop"
-	return r.cli.Del(svcPath).Err()
+	r.mu.Lock()
+	if shutdown, ok := r.registrations[svcPath]; ok {
+		close(shutdown)
+		delete(r.registrations, svcPath)
+	}
+	r.mu.Unlock()
+	if err := r.cli.Del(svcPath).Err(); err != nil {
+		return err
+	}
+	return r.cli.Publish(svcPrefix(name), addr).Err()
 }
@@ -0,0 +1,32 @@
+package redis
+
+import "time"
+
+const defaultPollInterval = 5 * time.Second
+
+type options struct {
+	pollInterval time.Duration
+}
+
+// Option configures redis naming registry
+type Option func(*options)
+
+// WithPollInterval sets how often resolver re-scans registered addresses
+// as a fallback when no pub/sub or keyspace notification is received
+func WithPollInterval(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.pollInterval = d
+		}
+	}
+}
+
+func newOptions(opts ...Option) *options {
+	o := &options{
+		pollInterval: defaultPollInterval,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
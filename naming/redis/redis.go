@@ -1,35 +1,67 @@
 package redis
 
 import (
+	"sync"
+
 	redisCli "github.com/go-redis/redis"
 	"github.com/whatvn/denny/log"
 	"github.com/whatvn/denny/naming"
+	"github.com/whatvn/denny/redisconn"
 	"google.golang.org/grpc/resolver"
 )
 
 type redis struct {
-	cli *redisCli.Client
+	cli redisCli.UniversalClient
 	*log.Log
-	shutdown    chan interface{}
 	cc          resolver.ClientConn
 	serviceName string
+	opts        *options
+	probe       naming.HealthProbe
+	// stop channels of refresh goroutines, keyed by registered key
+	mu            sync.Mutex
+	registrations map[string]chan struct{}
+	// resolver state, refresh is used by ResolveNow to trigger
+	// an immediate update, done stops watch goroutine on Close
+	refresh   chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
-func New(redisAddr, redisPassword, serviceName string) naming.Registry {
-	client := redisCli.NewClient(&redisCli.Options{
+func New(redisAddr, redisPassword, serviceName string, opts ...Option) naming.Registry {
+	return newRegistry(redisconn.Options{
 		Addr:     redisAddr,
 		Password: redisPassword,
-	})
+	}, serviceName, opts...)
+}
 
+// NewWithOptions creates redis registry using universal redis options,
+// which supports single redis server, redis sentinel and redis cluster
+func NewWithOptions(redisOpts redisconn.Options, serviceName string, opts ...Option) naming.Registry {
+	return newRegistry(redisOpts, serviceName, opts...)
+}
+
+func newRegistry(redisOpts redisconn.Options, serviceName string, opts ...Option) *redis {
 	registry := &redis{
-		cli:         client,
-		Log:         log.New(),
-		serviceName: serviceName,
-		shutdown:    make(chan interface{}, 1),
-	}
-	registry.WithField("redis", redisAddr)
-	if len(redisPassword) > 0 {
-		registry.WithField("redisPassword", redisPassword)
+		cli:           redisOpts.NewClient(),
+		Log:           log.New(),
+		serviceName:   serviceName,
+		opts:          newOptions(opts...),
+		registrations: make(map[string]chan struct{}),
+		refresh:       make(chan struct{}, 1),
+		done:          make(chan struct{}),
 	}
+	registry.WithField("redis", redisOpts.String())
 	return registry
 }
+
+// svcPrefix returns key prefix for all addresses of a service, it is also used
+// as pub/sub channel name to notify resolvers about register/unregister event
+func svcPrefix(serviceName string) string {
+	return "/" + naming.Prefix + "/" + serviceName + "/"
+}
+
+var (
+	_ naming.Registry        = new(redis)
+	_ naming.ServiceRegistry = new(redis)
+	_ naming.HealthReporter  = new(redis)
+)
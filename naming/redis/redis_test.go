@@ -0,0 +1,105 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/whatvn/denny/naming"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+type clientConn struct {
+	states chan resolver.State
+}
+
+func (c *clientConn) UpdateState(s resolver.State)  { c.states <- s }
+func (c *clientConn) ReportError(error)             {}
+func (c *clientConn) NewAddress([]resolver.Address) {}
+func (c *clientConn) NewServiceConfig(string)       {}
+func (c *clientConn) ParseServiceConfig(string) *serviceconfig.ParseResult {
+	return nil
+}
+
+func waitState(t *testing.T, cc *clientConn, n int) resolver.State {
+	for {
+		select {
+		case s := <-cc.states:
+			if len(s.Addresses) == n {
+				return s
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("expect %d addresses", n)
+		}
+	}
+}
+
+func TestRedisRegistry(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	var (
+		cc       = &clientConn{states: make(chan resolver.State, 10)}
+		registry = New(server.Addr(), "", "demo.svc", WithPollInterval(100*time.Millisecond))
+		svcPath  = svcPrefix("demo.svc") + "10.0.0.1:8080"
+	)
+	r, err := registry.Build(resolver.Target{Scheme: registry.Scheme(), Endpoint: "demo.svc"}, cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, cc, 0)
+
+	if err := registry.Register("10.0.0.1:8080", 1); err != nil {
+		t.Fatal(err)
+	}
+	state := waitState(t, cc, 1)
+	if state.Addresses[0].Addr != "10.0.0.1:8080" {
+		t.Errorf("unexpected address %s", state.Addresses[0].Addr)
+	}
+	if ttl := server.TTL(svcPath); ttl != 2*time.Second {
+		t.Errorf("expect key to expire after twice ttl, got %v", ttl)
+	}
+
+	// other service registered by the same registry is not resolved for demo.svc
+	if err := registry.(naming.ServiceRegistry).RegisterService(naming.Service{Name: "other.svc", Addr: "10.0.0.2:8080"}); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := server.TTL(svcPrefix("other.svc") + "10.0.0.2:8080"); ttl != 2*naming.DefaultTTL*time.Second {
+		t.Errorf("expect default ttl, got %v", ttl)
+	}
+
+	if err := registry.UnRegister("10.0.0.1:8080"); err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, cc, 0)
+	if server.Exists(svcPath) {
+		t.Error("unregistered address is kept")
+	}
+
+	// close stops heartbeats of every registration
+	if err := registry.Register("10.0.0.1:8080", 1); err != nil {
+		t.Fatal(err)
+	}
+	impl := registry.(*redis)
+	impl.mu.Lock()
+	var heartbeats []chan struct{}
+	for _, shutdown := range impl.registrations {
+		heartbeats = append(heartbeats, shutdown)
+	}
+	impl.mu.Unlock()
+	if len(heartbeats) != 2 {
+		t.Fatalf("expect 2 registrations, got %d", len(heartbeats))
+	}
+	r.Close()
+	for _, shutdown := range heartbeats {
+		select {
+		case <-shutdown:
+		default:
+			t.Error("heartbeat is not stopped by Close")
+		}
+	}
+}
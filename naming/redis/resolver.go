@@ -2,23 +2,36 @@ package redis
 
 import (
 	"errors"
-	"github.com/whatvn/denny/naming"
-	"google.golang.org/grpc/resolver"
 	"strings"
+	"sync"
 	"time"
+
+	redisCli "github.com/go-redis/redis"
+	"github.com/whatvn/denny/naming"
+	"github.com/whatvn/denny/redisconn"
+	"google.golang.org/grpc/resolver"
 )
 
+const scanCount = 100
+
 // NewResolver is alias to New(), and also register resolver automatically
 // so client does not have to call register resolver everytime
-func NewResolver(redisAddr, redisPwd, serviceName string) naming.Registry {
-	registry := New(redisAddr, redisPwd, serviceName)
+func NewResolver(redisAddr, redisPwd, serviceName string, opts ...Option) naming.Registry {
+	registry := New(redisAddr, redisPwd, serviceName, opts...)
+	resolver.Register(registry)
+	return registry
+}
+
+// NewResolverWithOptions is alias to NewWithOptions(), and also register resolver automatically
+func NewResolverWithOptions(redisOpts redisconn.Options, serviceName string, opts ...Option) naming.Registry {
+	registry := NewWithOptions(redisOpts, serviceName, opts...)
 	resolver.Register(registry)
 	return registry
 }
 
 func (r *redis) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
 	if r.cli == nil {
-		return nil, errors.New("etcd client was not initialised")
+		return nil, errors.New("redis client was not initialised")
 	}
 	r.cc = cc
 	r.WithFields(map[string]interface{}{
@@ -30,13 +43,26 @@ func (r *redis) Build(target resolver.Target, cc resolver.ClientConn, opts resol
 	return r, nil
 }
 
+// watch keeps grpc address list in sync with redis, it is triggered by:
+// register/unregister messages published on keyPrefix channel,
+// keyspace notifications (set/expired/del) when they are enabled on redis server,
+// ResolveNow calls and a poll ticker as fallback
 func (r *redis) watch(keyPrefix string) {
 	var (
 		addrList []resolver.Address
-		ticker   = time.NewTicker(time.Duration(5) * time.Second)
+		ticker   = time.NewTicker(r.opts.pollInterval)
+		pubSub   = r.cli.Subscribe(keyPrefix)
+		events   <-chan *redisCli.Message
 	)
+	defer ticker.Stop()
+	defer pubSub.Close()
 
-	list, err := r.addressList(keyPrefix, addrList)
+	if err := pubSub.PSubscribe("__keyspace@*__:" + keyPrefix + "*"); err != nil {
+		r.Errorf("cannot subscribe to keyspace notification: %v", err)
+	}
+	events = pubSub.Channel()
+
+	list, err := r.addressList(keyPrefix)
 	if err != nil {
 		r.Errorf("cannot get address list: %v", err)
 	} else {
@@ -49,63 +75,131 @@ func (r *redis) watch(keyPrefix string) {
 
 	for {
 		select {
-		case _ = <-ticker.C:
-			updatedList, err := r.addressList(keyPrefix, addrList)
-			if err != nil {
-				r.Errorf("cannot get address list: %v", err)
-			} else {
-				needUpdate := false
-				// append to state list if it's not exist
-				for _, addr := range updatedList {
-					if !naming.Exist(addrList, addr.Addr) {
-						needUpdate = true
-						addrList = append(addrList, addr)
-					}
-				}
-
-				// remove dead peer
-				for _, addr := range addrList {
-					if !naming.Exist(updatedList, addr.Addr) {
-						needUpdate = true
-						if s, ok := naming.Remove(addrList, addr.Addr); ok {
-							addrList = s
-						}
-					}
-				}
+		case <-r.done:
+			return
+		case <-ticker.C:
+		case <-r.refresh:
+		case <-events:
+		}
+		updatedList, err := r.addressList(keyPrefix)
+		if err != nil {
+			r.Errorf("cannot get address list: %v", err)
+			continue
+		}
+		needUpdate := false
+		// append to state list if it's not exist
+		for _, addr := range updatedList {
+			if !naming.Exist(addrList, addr.Addr) {
+				needUpdate = true
+				addrList = append(addrList, addr)
+			}
+		}
 
-				if needUpdate {
-					r.cc.UpdateState(resolver.State{Addresses: addrList})
+		// remove dead peer
+		for _, addr := range addrList {
+			if !naming.Exist(updatedList, addr.Addr) {
+				needUpdate = true
+				if s, ok := naming.Remove(addrList, addr.Addr); ok {
+					addrList = s
 				}
 			}
-
 		}
 
+		if needUpdate {
+			r.cc.UpdateState(resolver.State{Addresses: addrList})
+		}
 	}
 }
 
-func (r *redis) addressList(keyPrefix string, addrList []resolver.Address) ([]resolver.Address, error) {
-	resp, err := r.cli.Keys(keyPrefix + "*").Result()
+// addressList uses SCAN instead of KEYS so lookup does not block redis
+// server when keyspace is large, in cluster mode every master node is scanned,
+// entries which are marked unhealthy are skipped
+func (r *redis) addressList(keyPrefix string) ([]resolver.Address, error) {
+	var (
+		addrList []resolver.Address
+		mu       sync.Mutex
+		scan     = func(cli redisCli.Cmdable) error {
+			var (
+				iter = cli.Scan(0, keyPrefix+"*", scanCount).Iterator()
+				pipe = cli.Pipeline()
+				cmds []*redisCli.StringCmd
+				keys []string
+			)
+			defer pipe.Close()
+			for iter.Next() {
+				keys = append(keys, iter.Val())
+				cmds = append(cmds, pipe.Get(iter.Val()))
+			}
+			if err := iter.Err(); err != nil {
+				return err
+			}
+			if len(cmds) == 0 {
+				return nil
+			}
+			if _, err := pipe.Exec(); err != nil && err != redisCli.Nil {
+				return err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for i, cmd := range cmds {
+				value, err := cmd.Result()
+				if err != nil {
+					// key expired between SCAN and GET
+					continue
+				}
+				if !naming.DecodeEndpoint(value).Healthy {
+					continue
+				}
+				addr := strings.TrimPrefix(keys[i], keyPrefix)
+				if !naming.Exist(addrList, addr) {
+					addrList = append(addrList, resolver.Address{Addr: addr})
+				}
+			}
+			return nil
+		}
+		err error
+	)
+	if cluster, ok := r.cli.(*redisCli.ClusterClient); ok {
+		err = cluster.ForEachMaster(func(cli *redisCli.Client) error {
+			return scan(cli)
+		})
+	} else {
+		err = scan(r.cli)
+	}
 	if err != nil {
 		return nil, err
 	}
-	for _, key := range resp {
-		addrList = append(addrList, resolver.Address{Addr: strings.TrimPrefix(key, keyPrefix)})
-	}
 	return addrList, nil
 }
 
-func (r redis) Scheme() string {
+func (r *redis) Scheme() string {
 	return naming.Prefix
 }
 
-func (r redis) SvcName() string {
+func (r *redis) SvcName() string {
 	return r.Scheme() + ":///" + r.serviceName
 }
 
+// ResolveNow forces resolver to reload address list from redis immediately
 func (r *redis) ResolveNow(resolver.ResolveNowOptions) {
-	// TODO
+	select {
+	case r.refresh <- struct{}{}:
+	default:
+		// a refresh is already pending
+	}
 }
 
+// Close stops watch goroutine and heartbeats of registered addresses and closes redis client,
+// registered addresses are not removed, they expire after their ttl
 func (r *redis) Close() {
-	_ = r.cli.Close()
+	r.closeOnce.Do(func() {
+		close(r.done)
+		r.mu.Lock()
+		for svcPath, shutdown := range r.registrations {
+			close(shutdown)
+			delete(r.registrations, svcPath)
+		}
+		r.mu.Unlock()
+		_ = r.cli.Close()
+	})
 }
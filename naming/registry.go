@@ -51,3 +51,38 @@ func Remove(s []resolver.Address, addr string) ([]resolver.Address, bool) {
 	}
 	return nil, false
 }
+
+// DefaultTTL is used for service registered without TTL, in seconds
+const DefaultTTL = 5
+
+// Service describes one registration in naming storage
+type Service struct {
+	// Name is service name clients resolve, eg: full proto service name
+	Name string
+	Addr string
+	// TTL in seconds, DefaultTTL is used when it's not positive
+	TTL      int
+	Metadata map[string]string
+}
+
+// WithDefaults returns service with DefaultTTL when TTL is not set
+func (s Service) WithDefaults() Service {
+	if s.TTL <= 0 {
+		s.TTL = DefaultTTL
+	}
+	return s
+}
+
+// ServiceRegistry is implemented by registries which can register an address under
+// service names other than the one they were created with, so one process can advertise
+// every grpc service it serves
+type ServiceRegistry interface {
+	RegisterService(svc Service) error
+	UnRegisterService(name, addr string) error
+}
+
+// Target returns url of given service name which can be resolved by registry,
+// it is SvcName() of a registry created with that service name
+func Target(registry Registry, serviceName string) string {
+	return registry.Scheme() + ":///" + serviceName
+}
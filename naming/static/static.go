@@ -0,0 +1,237 @@
+// package static is naming registry for local development and tests, addresses come from
+// a fixed list, a json file which is reloaded on change, or are registered in-process
+package static
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/whatvn/denny/go_config/source"
+	"github.com/whatvn/denny/go_config/source/file"
+	"github.com/whatvn/denny/log"
+	"github.com/whatvn/denny/naming"
+	"google.golang.org/grpc/resolver"
+)
+
+type static struct {
+	*log.Log
+	sync.Mutex
+	serviceName string
+	// fixed addresses, from New or from file
+	fixed []string
+	// addresses registered in this process
+	registered []string
+	src        source.Source
+	cc         resolver.ClientConn
+	watcher    source.Watcher
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+// New static
+// implement github.com/whatvn/denny/naming#Registry
+// resolver always returns given addresses plus addresses registered in the same process
+func New(serviceName string, addrs ...string) naming.Registry {
+	if len(serviceName) == 0 {
+		panic(errors.New("invalid service name"))
+	}
+	registry := &static{
+		Log:         log.New(),
+		serviceName: serviceName,
+		fixed:       addrs,
+		done:        make(chan struct{}),
+	}
+	registry.WithField("static", addrs)
+	return registry
+}
+
+// NewFromFile reads addresses from json file, file content is either a list of addresses:
+//
+//	["127.0.0.1:8080", "127.0.0.1:8081"]
+//
+// or a map of service name to addresses so one file can be shared by many services:
+//
+//	{"demo.brpc.svc": ["127.0.0.1:8080"], "demo.admin.svc": ["127.0.0.1:9090"]}
+//
+// file is watched and address list is reloaded whenever it changes
+func NewFromFile(path, serviceName string) (naming.Registry, error) {
+	if len(serviceName) == 0 {
+		return nil, errors.New("invalid service name")
+	}
+	registry := &static{
+		Log:         log.New(),
+		serviceName: serviceName,
+		src:         file.NewSource(file.WithPath(path)),
+		done:        make(chan struct{}),
+	}
+	registry.WithField("static", path)
+	cs, err := registry.src.Read()
+	if err != nil {
+		return nil, err
+	}
+	if registry.fixed, err = registry.parse(cs.Data); err != nil {
+		return nil, err
+	}
+	return registry, nil
+}
+
+// NewResolver is alias to New(), and also register resolver automatically
+// so client does not have to call register resolver everytime
+func NewResolver(serviceName string, addrs ...string) naming.Registry {
+	registry := New(serviceName, addrs...)
+	resolver.Register(registry)
+	return registry
+}
+
+// NewResolverFromFile is alias to NewFromFile(), and also register resolver automatically
+func NewResolverFromFile(path, serviceName string) (naming.Registry, error) {
+	registry, err := NewFromFile(path, serviceName)
+	if err != nil {
+		return nil, err
+	}
+	resolver.Register(registry)
+	return registry, nil
+}
+
+func (r *static) parse(data []byte) ([]string, error) {
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		return list, nil
+	}
+	var services map[string][]string
+	if err := json.Unmarshal(data, &services); err != nil {
+		return nil, err
+	}
+	return services[r.serviceName], nil
+}
+
+// Register adds address to in-process address list, it's useful for tests which
+// start server and client in the same process
+func (r *static) Register(addr string, ttl int) error {
+	r.Lock()
+	if !contains(r.registered, addr) {
+		r.registered = append(r.registered, addr)
+	}
+	r.Unlock()
+	r.updateState()
+	return nil
+}
+
+// UnRegister removes address from in-process address list
+func (r *static) UnRegister(addr string) error {
+	r.Lock()
+	for i := range r.registered {
+		if r.registered[i] == addr {
+			r.registered = append(r.registered[:i], r.registered[i+1:]...)
+			break
+		}
+	}
+	r.Unlock()
+	r.updateState()
+	return nil
+}
+
+// Build implements grpc Builder.Build method so grpc client know how to construct resolver Builder
+func (r *static) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	r.Lock()
+	r.cc = cc
+	r.Unlock()
+	if r.src != nil {
+		watcher, err := r.src.Watch()
+		if err != nil {
+			return nil, err
+		}
+		r.watcher = watcher
+		go r.watch()
+	}
+	r.updateState()
+	return r, nil
+}
+
+func (r *static) watch() {
+	for {
+		cs, err := r.watcher.Next()
+		select {
+		case <-r.done:
+			return
+		default:
+		}
+		if err != nil {
+			if err == source.ErrWatcherStopped {
+				return
+			}
+			r.Errorf("cannot reload address list: %v", err)
+			continue
+		}
+		addrs, err := r.parse(cs.Data)
+		if err != nil {
+			// file may be in the middle of being written, keep current list
+			r.Errorf("cannot parse address list: %v", err)
+			continue
+		}
+		r.Lock()
+		r.fixed = addrs
+		r.Unlock()
+		r.updateState()
+	}
+}
+
+func (r *static) updateState() {
+	r.Lock()
+	cc := r.cc
+	var addrList []resolver.Address
+	for _, addrs := range [][]string{r.fixed, r.registered} {
+		for _, addr := range addrs {
+			if !naming.Exist(addrList, addr) {
+				addrList = append(addrList, resolver.Address{Addr: addr})
+			}
+		}
+	}
+	r.Unlock()
+	if cc == nil {
+		return
+	}
+	sort.Slice(addrList, func(i, j int) bool {
+		return addrList[i].Addr < addrList[j].Addr
+	})
+	cc.UpdateState(resolver.State{Addresses: addrList})
+}
+
+// Scheme implements Builder.Scheme method to get prefix hint for grpc resolver
+func (r *static) Scheme() string {
+	return naming.Prefix
+}
+
+// SvcName is shortcut for client's user, it return full service url
+// so clients does not have to construct service url themself
+func (r *static) SvcName() string {
+	return r.Scheme() + ":///" + r.serviceName
+}
+
+// ResolveNow pushes current address list to grpc client again
+func (r *static) ResolveNow(rn resolver.ResolveNowOptions) {
+	r.updateState()
+}
+
+// Close stops file watcher
+func (r *static) Close() {
+	r.closeOnce.Do(func() {
+		close(r.done)
+		if r.watcher != nil {
+			_ = r.watcher.Stop()
+		}
+	})
+}
+
+func contains(l []string, s string) bool {
+	for i := range l {
+		if l[i] == s {
+			return true
+		}
+	}
+	return false
+}
+
+var _ naming.Registry = new(static)
@@ -0,0 +1,91 @@
+package static
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+type clientConn struct {
+	states chan resolver.State
+}
+
+func (c *clientConn) UpdateState(s resolver.State)  { c.states <- s }
+func (c *clientConn) ReportError(error)             {}
+func (c *clientConn) NewAddress([]resolver.Address) {}
+func (c *clientConn) NewServiceConfig(string)       {}
+func (c *clientConn) ParseServiceConfig(string) *serviceconfig.ParseResult {
+	return nil
+}
+
+func waitAddresses(t *testing.T, cc *clientConn, addrs ...string) {
+	for {
+		select {
+		case s := <-cc.states:
+			if len(s.Addresses) != len(addrs) {
+				continue
+			}
+			for i := range addrs {
+				if s.Addresses[i].Addr != addrs[i] {
+					t.Fatalf("expect %v, got %v", addrs, s.Addresses)
+				}
+			}
+			return
+		case <-time.After(3 * time.Second):
+			t.Fatalf("expect addresses %v", addrs)
+		}
+	}
+}
+
+func TestStaticRegistry(t *testing.T) {
+	var (
+		registry = New("demo.svc", "127.0.0.1:8080")
+		cc       = &clientConn{states: make(chan resolver.State, 10)}
+	)
+	r, err := registry.Build(resolver.Target{Scheme: registry.Scheme(), Endpoint: "demo.svc"}, cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	waitAddresses(t, cc, "127.0.0.1:8080")
+
+	_ = registry.Register("127.0.0.1:8081", 5)
+	waitAddresses(t, cc, "127.0.0.1:8080", "127.0.0.1:8081")
+
+	_ = registry.UnRegister("127.0.0.1:8081")
+	waitAddresses(t, cc, "127.0.0.1:8080")
+}
+
+func TestStaticRegistryFromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "services.json")
+	if err = ioutil.WriteFile(path, []byte(`{"demo.svc": ["127.0.0.1:8080"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	registry, err := NewFromFile(path, "demo.svc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc := &clientConn{states: make(chan resolver.State, 10)}
+	r, err := registry.Build(resolver.Target{Scheme: registry.Scheme(), Endpoint: "demo.svc"}, cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	waitAddresses(t, cc, "127.0.0.1:8080")
+
+	if err = ioutil.WriteFile(path, []byte(`{"demo.svc": ["127.0.0.1:8080", "127.0.0.1:9090"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitAddresses(t, cc, "127.0.0.1:8080", "127.0.0.1:9090")
+}
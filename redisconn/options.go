@@ -0,0 +1,86 @@
+// Package redisconn describes redis connection shared by redis cache and redis naming registry
+package redisconn
+
+import (
+	"crypto/tls"
+	"strings"
+	"time"
+
+	redisCli "github.com/go-redis/redis"
+)
+
+// Options is universal redis connection options, shared by cache and naming redis registry.
+// Connection mode is decided by given fields:
+//   - MasterName is set: sentinel (failover) mode, SentinelAddrs are sentinel servers
+//   - ClusterAddrs is set: cluster mode, ClusterAddrs are seed nodes
+//   - otherwise: single server at Addr
+type Options struct {
+	// single server address, host:port
+	Addr string
+	// sentinel master name and sentinel servers address
+	MasterName    string
+	SentinelAddrs []string
+	// cluster seed nodes
+	ClusterAddrs []string
+
+	Password string
+	// database index, not supported in cluster mode
+	DB        int
+	TLSConfig *tls.Config
+	PoolSize  int
+
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+}
+
+// NewClient creates redis client which matches connection mode described by options
+func (o Options) NewClient() redisCli.UniversalClient {
+	switch {
+	case len(o.MasterName) > 0:
+		return redisCli.NewFailoverClient(&redisCli.FailoverOptions{
+			MasterName:    o.MasterName,
+			SentinelAddrs: o.SentinelAddrs,
+			Password:      o.Password,
+			DB:            o.DB,
+			TLSConfig:     o.TLSConfig,
+			PoolSize:      o.PoolSize,
+			DialTimeout:   o.DialTimeout,
+			ReadTimeout:   o.ReadTimeout,
+			WriteTimeout:  o.WriteTimeout,
+		})
+	case len(o.ClusterAddrs) > 0:
+		return redisCli.NewClusterClient(&redisCli.ClusterOptions{
+			Addrs:        o.ClusterAddrs,
+			Password:     o.Password,
+			TLSConfig:    o.TLSConfig,
+			PoolSize:     o.PoolSize,
+			DialTimeout:  o.DialTimeout,
+			ReadTimeout:  o.ReadTimeout,
+			WriteTimeout: o.WriteTimeout,
+		})
+	default:
+		return redisCli.NewClient(&redisCli.Options{
+			Addr:         o.Addr,
+			Password:     o.Password,
+			DB:           o.DB,
+			TLSConfig:    o.TLSConfig,
+			PoolSize:     o.PoolSize,
+			DialTimeout:  o.DialTimeout,
+			ReadTimeout:  o.ReadTimeout,
+			WriteTimeout: o.WriteTimeout,
+		})
+	}
+}
+
+// String returns servers list for logging purpose
+func (o Options) String() string {
+	switch {
+	case len(o.MasterName) > 0:
+		return o.MasterName + "@" + strings.Join(o.SentinelAddrs, ",")
+	case len(o.ClusterAddrs) > 0:
+		return strings.Join(o.ClusterAddrs, ",")
+	default:
+		return o.Addr
+	}
+}
@@ -0,0 +1,31 @@
+package redisconn
+
+import (
+	"testing"
+
+	redisCli "github.com/go-redis/redis"
+)
+
+func TestRedisOptionsClient(t *testing.T) {
+	var (
+		single = Options{Addr: "127.0.0.1:6379"}.NewClient()
+		// failover client is a redis.Client connected through sentinel
+		sentinel = Options{MasterName: "master", SentinelAddrs: []string{"127.0.0.1:26379"}}.NewClient()
+		cluster  = Options{ClusterAddrs: []string{"127.0.0.1:7000", "127.0.0.1:7001"}}.NewClient()
+	)
+	defer func() {
+		_ = single.Close()
+		_ = sentinel.Close()
+		_ = cluster.Close()
+	}()
+
+	if _, ok := single.(*redisCli.Client); !ok {
+		t.Error("expect single redis client")
+	}
+	if _, ok := sentinel.(*redisCli.Client); !ok {
+		t.Error("expect failover redis client")
+	}
+	if _, ok := cluster.(*redisCli.ClusterClient); !ok {
+		t.Error("expect cluster redis client")
+	}
+}
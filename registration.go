@@ -0,0 +1,102 @@
+package denny
+
+import (
+	"sort"
+
+	"github.com/whatvn/denny/naming"
+)
+
+const defaultRegistryTTL = 5
+
+// ServiceRegistration overrides how a grpc service is registered into naming registry
+type ServiceRegistration struct {
+	// Name is registered service name, default is full proto service name, eg: pb.HelloService
+	Name string
+	// TTL in seconds, default is 5
+	TTL      int
+	Metadata map[string]string
+	// Skip does not register this service
+	Skip bool
+}
+
+// WithServiceRegistration overrides registration of grpc service with given full proto name,
+// by default every service attached to grpc server is registered under its full proto name
+// when registry implements naming.ServiceRegistry
+func (r *Denny) WithServiceRegistration(fullName string, registration ServiceRegistration) *Denny {
+	r.Lock()
+	defer r.Unlock()
+	if r.serviceRegistrations == nil {
+		r.serviceRegistrations = make(map[string]ServiceRegistration)
+	}
+	r.serviceRegistrations[fullName] = registration
+	return r
+}
+
+// services returns registrations of grpc services served by Denny, ordered by name
+func (r *Denny) services(addr string) []naming.Service {
+	var services []naming.Service
+	r.Lock()
+	defer r.Unlock()
+	if r.grpcServer == nil {
+		return nil
+	}
+	for fullName := range r.grpcServer.GetServiceInfo() {
+		registration := r.serviceRegistrations[fullName]
+		if registration.Skip {
+			continue
+		}
+		svc := naming.Service{
+			Name:     fullName,
+			Addr:     addr,
+			TTL:      defaultRegistryTTL,
+			Metadata: registration.Metadata,
+		}
+		if len(registration.Name) > 0 {
+			svc.Name = registration.Name
+		}
+		if registration.TTL > 0 {
+			svc.TTL = registration.TTL
+		}
+		// already registered under registry's own service name
+		if naming.Target(r.registry, svc.Name) == r.registry.SvcName() {
+			continue
+		}
+		services = append(services, svc)
+	}
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].Name < services[j].Name
+	})
+	return services
+}
+
+// register registers addr under registry service name, then every grpc service
+// if registry supports multiple service names
+func (r *Denny) register(addr string) error {
+	if err := r.registry.Register(addr, defaultRegistryTTL); err != nil {
+		return err
+	}
+	serviceRegistry, ok := r.registry.(naming.ServiceRegistry)
+	if !ok {
+		return nil
+	}
+	for _, svc := range r.services(addr) {
+		r.Infof("register grpc service %s", svc.Name)
+		if err := serviceRegistry.RegisterService(svc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Denny) unregister(addr string) {
+	if serviceRegistry, ok := r.registry.(naming.ServiceRegistry); ok {
+		for _, svc := range r.services(addr) {
+			if err := serviceRegistry.UnRegisterService(svc.Name, addr); err != nil {
+				r.Errorf("cannot unregister %s: %v", svc.Name, err)
+			}
+		}
+	}
+	if err := r.registry.UnRegister(addr); err != nil {
+		r.Errorf("cannot unregister: %v", err)
+	}
+}
@@ -0,0 +1,272 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const defaultOTLPEndpoint = "http://localhost:4318/v1/traces"
+
+// otlpExporter sends spans to OTLP/HTTP endpoint using json encoding,
+// OTLP grpc and protobuf exporters require a newer grpc than the one denny is built with
+type otlpExporter struct {
+	endpoint string
+	headers  map[string]string
+	client   *http.Client
+}
+
+// NewOTLPExporter creates span exporter which sends spans to OTLP/HTTP traces endpoint
+// (eg: opentelemetry collector), http://localhost:4318/v1/traces is used when endpoint is empty
+func NewOTLPExporter(endpoint string, headers map[string]string) sdktrace.SpanExporter {
+	if endpoint == "" {
+		endpoint = defaultOTLPEndpoint
+	}
+	return &otlpExporter{endpoint: endpoint, headers: headers, client: &http.Client{}}
+}
+
+func (e *otlpExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(otlpRequest(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("otlp export to %s failed: %s", e.endpoint, resp.Status)
+	}
+	return nil
+}
+
+func (e *otlpExporter) Shutdown(ctx context.Context) error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+// OTLP json encoding, see https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string    `json:"stringValue,omitempty"`
+	BoolValue   *bool      `json:"boolValue,omitempty"`
+	IntValue    *string    `json:"intValue,omitempty"`
+	DoubleValue *float64   `json:"doubleValue,omitempty"`
+	ArrayValue  *otlpArray `json:"arrayValue,omitempty"`
+}
+
+type otlpArray struct {
+	Values []otlpValue `json:"values"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []*otlpScopeSpans `json:"scopeSpans"`
+	SchemaURL  string            `json:"schemaUrl,omitempty"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name    string `json:"name"`
+		Version string `json:"version,omitempty"`
+	} `json:"scope"`
+	Spans     []otlpSpan `json:"spans"`
+	SchemaURL string     `json:"schemaUrl,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	TraceState        string         `json:"traceState,omitempty"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Events            []otlpEvent    `json:"events,omitempty"`
+	Links             []otlpLink     `json:"links,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpLink struct {
+	TraceID    string         `json:"traceId"`
+	SpanID     string         `json:"spanId"`
+	Attributes []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+func otlpRequest(spans []sdktrace.ReadOnlySpan) map[string]interface{} {
+	var (
+		resources  []*otlpResourceSpans
+		byResource = make(map[attribute.Distinct]*otlpResourceSpans)
+		byScope    = make(map[attribute.Distinct]map[instrumentation.Library]*otlpScopeSpans)
+	)
+	for _, span := range spans {
+		res := span.Resource()
+		if res == nil {
+			res = resource.Empty()
+		}
+		key := res.Equivalent()
+		rs, ok := byResource[key]
+		if !ok {
+			rs = &otlpResourceSpans{SchemaURL: res.SchemaURL()}
+			rs.Resource.Attributes = otlpAttributes(res.Attributes())
+			byResource[key] = rs
+			byScope[key] = make(map[instrumentation.Library]*otlpScopeSpans)
+			resources = append(resources, rs)
+		}
+		lib := span.InstrumentationLibrary()
+		ss, ok := byScope[key][lib]
+		if !ok {
+			ss = &otlpScopeSpans{SchemaURL: lib.SchemaURL}
+			ss.Scope.Name, ss.Scope.Version = lib.Name, lib.Version
+			byScope[key][lib] = ss
+			rs.ScopeSpans = append(rs.ScopeSpans, ss)
+		}
+		ss.Spans = append(ss.Spans, toOTLPSpan(span))
+	}
+	return map[string]interface{}{"resourceSpans": resources}
+}
+
+func toOTLPSpan(span sdktrace.ReadOnlySpan) otlpSpan {
+	sc := span.SpanContext()
+	s := otlpSpan{
+		TraceID:           sc.TraceID().String(),
+		SpanID:            sc.SpanID().String(),
+		TraceState:        sc.TraceState().String(),
+		Name:              span.Name(),
+		Kind:              otlpKind(span.SpanKind()),
+		StartTimeUnixNano: strconv.FormatInt(span.StartTime().UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.EndTime().UnixNano(), 10),
+		Attributes:        otlpAttributes(span.Attributes()),
+		Status:            otlpStatus{Message: span.Status().Description},
+	}
+	if parent := span.Parent(); parent.HasSpanID() {
+		s.ParentSpanID = parent.SpanID().String()
+	}
+	// OTLP status codes: 0 unset, 1 ok, 2 error
+	switch span.Status().Code {
+	case codes.Ok:
+		s.Status.Code = 1
+	case codes.Error:
+		s.Status.Code = 2
+	}
+	for _, event := range span.Events() {
+		s.Events = append(s.Events, otlpEvent{
+			TimeUnixNano: strconv.FormatInt(event.Time.UnixNano(), 10),
+			Name:         event.Name,
+			Attributes:   otlpAttributes(event.Attributes),
+		})
+	}
+	for _, link := range span.Links() {
+		s.Links = append(s.Links, otlpLink{
+			TraceID:    link.SpanContext.TraceID().String(),
+			SpanID:     link.SpanContext.SpanID().String(),
+			Attributes: otlpAttributes(link.Attributes),
+		})
+	}
+	return s
+}
+
+// otlpKind maps span kind, values of trace.SpanKind match OTLP except unspecified
+func otlpKind(kind trace.SpanKind) int {
+	if kind < trace.SpanKindInternal || kind > trace.SpanKindConsumer {
+		return int(trace.SpanKindInternal)
+	}
+	return int(kind)
+}
+
+func otlpAttributes(attrs []attribute.KeyValue) []otlpKeyValue {
+	if len(attrs) == 0 {
+		return nil
+	}
+	kvs := make([]otlpKeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		kvs = append(kvs, otlpKeyValue{Key: string(attr.Key), Value: toOTLPValue(attr.Value)})
+	}
+	return kvs
+}
+
+func toOTLPValue(v attribute.Value) otlpValue {
+	switch v.Type() {
+	case attribute.BOOL:
+		b := v.AsBool()
+		return otlpValue{BoolValue: &b}
+	case attribute.INT64:
+		i := strconv.FormatInt(v.AsInt64(), 10)
+		return otlpValue{IntValue: &i}
+	case attribute.FLOAT64:
+		f := v.AsFloat64()
+		return otlpValue{DoubleValue: &f}
+	case attribute.BOOLSLICE:
+		var values []otlpValue
+		for _, b := range v.AsBoolSlice() {
+			values = append(values, toOTLPValue(attribute.BoolValue(b)))
+		}
+		return otlpValue{ArrayValue: &otlpArray{Values: values}}
+	case attribute.INT64SLICE:
+		var values []otlpValue
+		for _, i := range v.AsInt64Slice() {
+			values = append(values, toOTLPValue(attribute.Int64Value(i)))
+		}
+		return otlpValue{ArrayValue: &otlpArray{Values: values}}
+	case attribute.FLOAT64SLICE:
+		var values []otlpValue
+		for _, f := range v.AsFloat64Slice() {
+			values = append(values, toOTLPValue(attribute.Float64Value(f)))
+		}
+		return otlpValue{ArrayValue: &otlpArray{Values: values}}
+	case attribute.STRINGSLICE:
+		var values []otlpValue
+		for _, s := range v.AsStringSlice() {
+			values = append(values, toOTLPValue(attribute.StringValue(s)))
+		}
+		return otlpValue{ArrayValue: &otlpArray{Values: values}}
+	}
+	s := v.Emit()
+	return otlpValue{StringValue: &s}
+}
@@ -0,0 +1,65 @@
+package tracing
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// Config configures tracer provider, it can be read from config: config.Scan(&cfg, "tracing")
+type Config struct {
+	ServiceName string `json:"service_name"`
+	// Exporter is one of none (default), stdout or otlp
+	Exporter string `json:"exporter"`
+	// Endpoint is OTLP/HTTP traces endpoint, default http://localhost:4318/v1/traces
+	Endpoint string            `json:"endpoint"`
+	Headers  map[string]string `json:"headers"`
+	// SampleRatio is fraction of new traces which are sampled, 0 samples every trace,
+	// sampling decision of remote parent is respected
+	SampleRatio float64 `json:"sample_ratio"`
+	// Output is writer of stdout exporter, default os.Stdout
+	Output io.Writer `json:"-"`
+}
+
+// NewTracerProvider creates OpenTelemetry sdk tracer provider with exporter chosen by config,
+// caller should call Shutdown on provider when server stops to flush pending spans
+func NewTracerProvider(cfg Config) (*sdktrace.TracerProvider, error) {
+	sampler := sdktrace.AlwaysSample()
+	if cfg.SampleRatio > 0 && cfg.SampleRatio < 1 {
+		sampler = sdktrace.TraceIDRatioBased(cfg.SampleRatio)
+	}
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(cfg.ServiceName))),
+	}
+
+	switch cfg.Exporter {
+	case "", ExporterNone:
+	case ExporterStdout:
+		out := cfg.Output
+		if out == nil {
+			out = os.Stdout
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(out))
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	case ExporterOTLP:
+		opts = append(opts, sdktrace.WithBatcher(NewOTLPExporter(cfg.Endpoint, cfg.Headers)))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter: %q", cfg.Exporter)
+	}
+	return sdktrace.NewTracerProvider(opts...), nil
+}
@@ -0,0 +1,122 @@
+// Package tracing integrates OpenTelemetry tracing and metrics into Denny http and grpc servers
+package tracing
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/global"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/instrument/syncfloat64"
+	"go.opentelemetry.io/otel/metric/unit"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/whatvn/denny"
+
+// Telemetry holds OpenTelemetry providers used by a Denny instance,
+// global providers are used for nil fields, W3C tracecontext and baggage
+// are propagated when Propagator is nil
+type Telemetry struct {
+	TracerProvider trace.TracerProvider
+	MeterProvider  metric.MeterProvider
+	Propagator     propagation.TextMapPropagator
+
+	once         sync.Once
+	tracer       trace.Tracer
+	httpDuration syncfloat64.Histogram
+	rpcDuration  syncfloat64.Histogram
+}
+
+var defaultTelemetry = &Telemetry{}
+
+// Default returns telemetry which uses global OpenTelemetry providers
+func Default() *Telemetry {
+	return defaultTelemetry
+}
+
+func (t *Telemetry) init() {
+	t.once.Do(func() {
+		tp := t.TracerProvider
+		if tp == nil {
+			tp = otel.GetTracerProvider()
+		}
+		t.tracer = tp.Tracer(instrumentationName)
+
+		mp := t.MeterProvider
+		if mp == nil {
+			mp = global.MeterProvider()
+		}
+		meter := mp.Meter(instrumentationName)
+		// instruments fall back to no-op when meter fails to create them
+		t.httpDuration, _ = meter.SyncFloat64().Histogram("http.server.duration",
+			instrument.WithUnit(unit.Milliseconds),
+			instrument.WithDescription("duration of inbound http requests"))
+		t.rpcDuration, _ = meter.SyncFloat64().Histogram("rpc.server.duration",
+			instrument.WithUnit(unit.Milliseconds),
+			instrument.WithDescription("duration of inbound rpc calls"))
+	})
+}
+
+// Tracer returns tracer of denny instrumentation
+func (t *Telemetry) Tracer() trace.Tracer {
+	t.init()
+	return t.tracer
+}
+
+// TextMapPropagator returns propagator which injects and extracts span context
+func (t *Telemetry) TextMapPropagator() propagation.TextMapPropagator {
+	if t.Propagator != nil {
+		return t.Propagator
+	}
+	return propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+}
+
+// RecordHTTP records duration of an inbound http request
+func (t *Telemetry) RecordHTTP(ctx context.Context, d time.Duration, attrs ...attribute.KeyValue) {
+	t.init()
+	if t.httpDuration != nil {
+		t.httpDuration.Record(ctx, milliseconds(d), attrs...)
+	}
+}
+
+// RecordRPC records duration of an inbound rpc call
+func (t *Telemetry) RecordRPC(ctx context.Context, d time.Duration, attrs ...attribute.KeyValue) {
+	t.init()
+	if t.rpcDuration != nil {
+		t.rpcDuration.Record(ctx, milliseconds(d), attrs...)
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+type telemetryKey struct{}
+
+// WithTelemetry returns context carrying given telemetry, tracing middleware and interceptors use it
+func WithTelemetry(ctx context.Context, t *Telemetry) context.Context {
+	return context.WithValue(ctx, telemetryKey{}, t)
+}
+
+// FromContext returns telemetry attached to context or nil
+func FromContext(ctx context.Context) *Telemetry {
+	if ctx == nil {
+		return nil
+	}
+	t, _ := ctx.Value(telemetryKey{}).(*Telemetry)
+	return t
+}
+
+// FromContextOrDefault returns telemetry attached to context or default telemetry
+func FromContextOrDefault(ctx context.Context) *Telemetry {
+	if t := FromContext(ctx); t != nil {
+		return t
+	}
+	return Default()
+}
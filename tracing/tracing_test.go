@@ -0,0 +1,85 @@
+package tracing_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/whatvn/denny/middleware/http/otel"
+	"github.com/whatvn/denny/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRequestTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	telemetry := &tracing.Telemetry{TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))}
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(tracing.WithTelemetry(c.Request.Context(), telemetry))
+	}, otel.RequestTracer())
+	engine.GET("/hello/:name", func(c *gin.Context) { c.String(http.StatusOK, "hello") })
+
+	req := httptest.NewRequest(http.MethodGet, "/hello/denny", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	engine.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expect 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "/hello/:name" || span.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("unexpected span %s %s", span.Name(), span.SpanContext().TraceID())
+	}
+	if span.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Fatalf("expect remote parent, got %s", span.Parent().SpanID())
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		_ = json.Unmarshal(data, &body)
+	}))
+	defer server.Close()
+
+	provider, err := tracing.NewTracerProvider(tracing.Config{
+		ServiceName: "hello",
+		Exporter:    tracing.ExporterOTLP,
+		Endpoint:    server.URL,
+		Headers:     map[string]string{"Authorization": "Bearer secret"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := provider.Tracer("test").Start(context.Background(), "say-hello")
+	span.SetAttributes(attribute.Int("attempt", 2))
+	span.End()
+	if err := provider.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	resourceSpans := body["resourceSpans"].([]interface{})[0].(map[string]interface{})
+	spans := resourceSpans["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})
+	exported := spans[0].(map[string]interface{})
+	if exported["name"] != "say-hello" || exported["traceId"] != span.SpanContext().TraceID().String() {
+		t.Fatalf("unexpected span %v", exported)
+	}
+	attr := exported["attributes"].([]interface{})[0].(map[string]interface{})
+	if attr["value"].(map[string]interface{})["intValue"] != "2" {
+		t.Fatalf("unexpected attribute %v", attr)
+	}
+}